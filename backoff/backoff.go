@@ -4,36 +4,193 @@ package backoff
 // backoff helper.
 
 import (
+	"context"
 	"errors"
-	"math/rand"
+	"fmt"
 	"time"
 )
 
-// The concrete implementation of an exponential backoff helper
+// The concrete implementation of an exponential backoff helper. It
+// keeps track of the attempts made, so it is not safe for concurrent
+// use; share an ExponentialPolicy instead.
 type Exponential struct {
+	attempts
 	initialDelay time.Duration
 	nextDelay    time.Duration
+	baseDelay    time.Duration
+	prevDelay    time.Duration
 	jitter       time.Duration
 	scale        float64
+	maxDelay     time.Duration
+	strategy     JitterStrategy
+}
+
+// The bookkeeping shared by all backoff helpers: how many attempts
+// have been made, when the first one was, and how to sleep.
+type attempts struct {
 	maxTries     int32
 	currentTries int32
+	maxElapsed   time.Duration
+	started      time.Time
+	clock        Clock
+	rand         Rand
+}
+
+// A source of time for backoff helpers, mostly there to allow tests
+// to run without actually sleeping.
+type Clock interface {
+	Now() time.Time
+	// Sleep for d, returning early with ctx.Err() if the context
+	// is done first.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Implemented by helpers that can say what clock they use, so that
+// RetryError.Elapsed is measured with the same clock.
+type clocked interface {
+	helperClock() Clock
+}
+
+func (a *attempts) helperClock() Clock {
+	return a.clock
+}
+
+// Implemented by helpers with an elapsed time budget, so that
+// CallWithHelper can start it before the first call, rather than at
+// the first Again.
+type sessionStarter interface {
+	startSession(now time.Time)
+}
+
+// Start the elapsed time budget, unless it is already running.
+func (a *attempts) startSession(now time.Time) {
+	if a.started.IsZero() {
+		a.started = now
+	}
 }
 
 type BackoffHelper interface {
 	Again() bool
 }
 
+// A backoff helper that can stop waiting when a context is done.
+type ContextBackoffHelper interface {
+	BackoffHelper
+	AgainContext(ctx context.Context) error
+}
+
+// A backoff helper that hands out delays instead of sleeping, for use
+// with your own timers, select loops or schedulers. Each call to
+// NextBackOff counts as an attempt; once there are no attempts left,
+// it returns false.
+type DelayBackoffHelper interface {
+	BackoffHelper
+	NextBackOff() (time.Duration, bool)
+}
+
 type BackoffError string
 
 const StopBackoff BackoffError = "backoff intentionally terminated"
 const RetriesExhausted BackoffError = "backoff maximum attempts done"
+const BudgetExhausted BackoffError = "retry budget exhausted"
 
 func (e BackoffError) Error() string {
 	return string(e)
 }
 
-func randomDuration(max time.Duration) time.Duration {
-	next := rand.Int63n(int64(max))
+// Returned from CallWithHelper when the backoff helper has run out of
+// attempts, the retry budget has run out, or the context passed to
+// CallWithHelperContext is done. It matches its Reason
+// with errors.Is, as well as any of the errors returned from the
+// called function, most recent first, with errors.Is and errors.As.
+type RetryError struct {
+	// Why there were no more attempts: RetriesExhausted,
+	// BudgetExhausted or a wrapped context error. If nil,
+	// RetriesExhausted is assumed.
+	Reason error
+	// Number of calls made to the function.
+	Attempts int
+	// Time from the first call starting to giving up.
+	Elapsed time.Duration
+	// All errors returned from the function, in order.
+	Errors []error
+}
+
+// Return the last error returned from the called function.
+func (e *RetryError) Last() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e.Errors[len(e.Errors)-1]
+}
+
+func (e *RetryError) reason() error {
+	if e.Reason == nil {
+		return RetriesExhausted
+	}
+
+	return e.Reason
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%s after %d attempts in %v: %v", e.reason(), e.Attempts, e.Elapsed, e.Last())
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Last()
+}
+
+func (e *RetryError) Is(target error) bool {
+	if errors.Is(e.reason(), target) {
+		return true
+	}
+	for ix := len(e.Errors) - 1; ix >= 0; ix-- {
+		if errors.Is(e.Errors[ix], target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *RetryError) As(target any) bool {
+	for ix := len(e.Errors) - 1; ix >= 0; ix-- {
+		if errors.As(e.Errors[ix], target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A random duration in [0, max), drawn from r, or the global source
+// if r is nil.
+func randomDuration(r Rand, max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	if r == nil {
+		r = globalRand{}
+	}
+	next := r.Int63n(int64(max))
 
 	return time.Duration(next)
 }
@@ -41,25 +198,53 @@ func randomDuration(max time.Duration) time.Duration {
 // This creates an exponential backoff helper with somewhat sane default values
 func NewExponential() *Exponential {
 	helper := Exponential{
+		attempts:     newAttempts(),
 		initialDelay: 100 * time.Millisecond,
 		jitter:       50 * time.Millisecond,
 		scale:        2.0,
-		maxTries:     5,
-		currentTries: 0,
+		strategy:     AdditiveJitter,
 	}
 
-	helper.nextDelay = helper.initialDelay + randomDuration(helper.jitter)
+	helper.firstDelay()
 
 	return &helper
 }
 
-// Compute the next delay, this is essentially the current delay,
-// multiplied by the scale factor and some random jitter added.
+// Ask the jitter strategy for the next delay.
+func (e *Exponential) jittered() time.Duration {
+	return e.capped(e.strategy(JitterInput{
+		Base:     e.baseDelay,
+		Previous: e.prevDelay,
+		Initial:  e.initialDelay,
+		Jitter:   e.jitter,
+		Scale:    e.scale,
+		Rand:     e.rand,
+	}))
+}
+
+// Start over from the initial delay.
+func (e *Exponential) firstDelay() {
+	e.baseDelay = e.capped(e.initialDelay)
+	e.prevDelay = 0
+	e.nextDelay = e.jittered()
+}
+
+// Compute the next delay. With the default strategy, this is
+// essentially the current delay, multiplied by the scale factor and
+// some random jitter added.
 func (e *Exponential) updateDelay() {
-	jitter := randomDuration(e.jitter)
-	scaled := float64(e.nextDelay)
-	scaled = scaled * e.scale
-	e.nextDelay = time.Duration(scaled) + jitter
+	e.prevDelay = e.nextDelay
+	e.baseDelay = e.capped(time.Duration(float64(e.baseDelay) * e.scale))
+	e.nextDelay = e.jittered()
+}
+
+// Clamp a delay to the maximum delay, if one is set.
+func (e *Exponential) capped(dt time.Duration) time.Duration {
+	if e.maxDelay > 0 && dt > e.maxDelay {
+		return e.maxDelay
+	}
+
+	return dt
 }
 
 // Try another backoff step. If the maximum number of attempts haev
@@ -67,15 +252,89 @@ func (e *Exponential) updateDelay() {
 // are still attempts left, this will sleep the requisite time and
 // return true.
 func (e *Exponential) Again() bool {
-	if e.currentTries >= e.maxTries {
+	return e.AgainContext(context.Background()) == nil
+}
+
+// Wrap a context error, so it is clear it came from a backoff.
+func aborted(err error) error {
+	return fmt.Errorf("backoff aborted: %w", err)
+}
+
+// Try another backoff step, giving up if the context is done. If the
+// maximum number of attempts have been made, or the next sleep would
+// take the total time past the maximum elapsed time, this returns
+// RetriesExhausted. If the context is done, or its deadline would
+// pass before the next attempt, this returns (a wrapped) ctx.Err()
+// or context.DeadlineExceeded straight away. Otherwise, this sleeps
+// the requisite time and returns nil.
+func (e *Exponential) AgainContext(ctx context.Context) error {
+	return e.wait(ctx, e.capped(e.nextDelay), e.NextBackOff)
+}
+
+// Return the next delay and count it as an attempt, without
+// sleeping. Once the attempts or the maximum elapsed time have run
+// out, this returns false.
+func (e *Exponential) NextBackOff() (time.Duration, bool) {
+	return e.next(e.capped(e.nextDelay), e.updateDelay)
+}
+
+func newAttempts() attempts {
+	return attempts{maxTries: 5, clock: realClock{}, rand: globalRand{}}
+}
+
+// Check if another attempt, sleeping delta from now, is within the
+// maximum number of tries and the maximum elapsed time.
+func (a *attempts) allowed(now time.Time, delta time.Duration) bool {
+	if a.currentTries >= a.maxTries {
 		return false
 	}
-	e.currentTries++
-	delta := e.nextDelay
-	e.updateDelay()
+	a.startSession(now)
+
+	return a.maxElapsed <= 0 || now.Sub(a.started)+delta <= a.maxElapsed
+}
+
+// Count an attempt sleeping delta, if allowed. Then advance is called
+// to compute the delay after this one.
+func (a *attempts) next(delta time.Duration, advance func()) (time.Duration, bool) {
+	if !a.allowed(a.clock.Now(), delta) {
+		return 0, false
+	}
+	a.currentTries++
+	advance()
+
+	return delta, true
+}
+
+// Sleep for the delay returned by next, as described for
+// Exponential.AgainContext. The coming delay, delta, is needed up
+// front, so that nothing is counted if the context's deadline is too
+// close.
+func (a *attempts) wait(ctx context.Context, delta time.Duration, next func() (time.Duration, bool)) error {
+	if a.currentTries >= a.maxTries {
+		return RetriesExhausted
+	}
+	if err := ctx.Err(); err != nil {
+		return aborted(err)
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(a.clock.Now()) < delta {
+		return aborted(context.DeadlineExceeded)
+	}
+
+	delta, ok := next()
+	if !ok {
+		return RetriesExhausted
+	}
+	if err := a.clock.Sleep(ctx, delta); err != nil {
+		return aborted(err)
+	}
+
+	return nil
+}
 
-	time.Sleep(delta)
-	return true
+// Forget about all attempts made so far.
+func (a *attempts) reset() {
+	a.currentTries = 0
+	a.started = time.Time{}
 }
 
 // Set the maximum number of tries for a helper.
@@ -91,7 +350,7 @@ func (e *Exponential) SetRetries(n int32) *Exponential {
 func (e *Exponential) SetInitialDelay(dt time.Duration) *Exponential {
 	e.initialDelay = dt
 	if e.currentTries == 0 {
-		e.nextDelay = dt + randomDuration(e.jitter)
+		e.firstDelay()
 	}
 
 	return e
@@ -103,7 +362,56 @@ func (e *Exponential) SetInitialDelay(dt time.Duration) *Exponential {
 func (e *Exponential) SetJitter(dt time.Duration) *Exponential {
 	e.jitter = dt
 	if e.currentTries == 0 {
-		e.nextDelay = e.initialDelay + randomDuration(e.jitter)
+		e.firstDelay()
+	}
+
+	return e
+}
+
+// Set the longest single delay. Delays that would grow past this are
+// clamped to it. A zero value means no limit.
+func (e *Exponential) SetMaxDelay(dt time.Duration) *Exponential {
+	e.maxDelay = dt
+
+	return e
+}
+
+// Set the total time budget for a backoff session, counted from the
+// first Again after the helper was created or Reset, or from the
+// first call when used with CallWithHelper. Once the next
+// sleep would take the session past this, Again gives up. A zero
+// value means no limit.
+func (e *Exponential) SetMaxElapsed(dt time.Duration) *Exponential {
+	e.maxElapsed = dt
+
+	return e
+}
+
+// Set the strategy used to pick each delay, AdditiveJitter by
+// default. If there have been no attempts with this helper, also
+// recompute the next delay.
+func (e *Exponential) SetJitterStrategy(s JitterStrategy) *Exponential {
+	e.strategy = s
+	if e.currentTries == 0 {
+		e.firstDelay()
+	}
+
+	return e
+}
+
+// Set the clock used to measure elapsed time and to sleep.
+func (e *Exponential) SetClock(c Clock) *Exponential {
+	e.clock = c
+
+	return e
+}
+
+// Set the source of randomness for the jitter. If there have been no
+// attempts with this helper, also recompute the next delay.
+func (e *Exponential) SetRand(r Rand) *Exponential {
+	e.rand = r
+	if e.currentTries == 0 {
+		e.firstDelay()
 	}
 
 	return e
@@ -112,8 +420,8 @@ func (e *Exponential) SetJitter(dt time.Duration) *Exponential {
 // Reset a helper to "no tries, next delay will be initial delay plus
 // some random jitter".
 func (e *Exponential) Reset() *Exponential {
-	e.currentTries = 0
-	e.nextDelay = e.initialDelay + randomDuration(e.jitter)
+	e.reset()
+	e.firstDelay()
 
 	return e
 }
@@ -142,20 +450,90 @@ func (e *Exponential) SetScale(s float64) *Exponential {
 // helper's Again method will be called. This will continue until f
 // returns no error, the backoff helper has run its maximum number of
 // tries, or the error returned is the StopBackoff error from this
-// package.
+// package, a PermanentError or not retryable according to the
+// WithRetryable option.
 //
 // Whatever the last return value was from the function will be returned. If the
-func CallWithHelper[T any](h BackoffHelper, f func() (T, error)) (T, error) {
-	rv, err := f()
+// helper runs out of attempts, or the retry budget given with
+// WithBudget runs out, the error is a *RetryError carrying all errors
+// from the function.
+func CallWithHelper[T any](h BackoffHelper, f func() (T, error), opts ...CallOption) (T, error) {
+	return CallWithHelperContext(context.Background(), h, func(context.Context) (T, error) {
+		return f()
+	}, opts...)
+}
+
+// Call a function f, with repeated calls using a backoff helper, as
+// CallWithHelper, but stopping as soon as ctx is done. The context is
+// passed on to f.
+//
+// If the helper is a ContextBackoffHelper, it stops sleeping as soon
+// as the context is done, and never sleeps past its deadline. Either
+// way, once the context is done, the last return value from f is
+// returned together with a *RetryError, carrying all errors from f,
+// with a wrapped ctx.Err() as its Reason.
+func CallWithHelperContext[T any](ctx context.Context, h BackoffHelper, f func(context.Context) (T, error), opts ...CallOption) (T, error) {
+	var config callConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	if config.budget != nil {
+		config.budget.Deposit()
+	}
+	clock := Clock(realClock{})
+	if c, ok := h.(clocked); ok {
+		clock = c.helperClock()
+	}
+	start := clock.Now()
+	if s, ok := h.(sessionStarter); ok {
+		s.startSession(start)
+	}
+	rv, err := f(ctx)
+	var errs []error
+	giveUp := func(reason error) error {
+		return &RetryError{Reason: reason, Attempts: len(errs), Elapsed: clock.Now().Sub(start), Errors: errs}
+	}
 
 	for err != nil {
 		if errors.Is(err, StopBackoff) {
 			return rv, err
 		}
-		if !h.Again() {
-			return rv, RetriesExhausted
+		var pe *PermanentError
+		if errors.As(err, &pe) {
+			// Only unwrap the permanent marker if that is
+			// all there is, otherwise keep the caller's
+			// wrapping intact.
+			if err == error(pe) {
+				return rv, pe.Err
+			}
+			return rv, err
+		}
+		if config.retryable != nil && !config.retryable(err) {
+			return rv, err
+		}
+		errs = append(errs, err)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return rv, giveUp(aborted(ctxErr))
+		}
+
+		if config.budget != nil && !config.budget.Withdraw() {
+			return rv, giveUp(BudgetExhausted)
+		}
+
+		var againErr error = RetriesExhausted
+		if ch, ok := h.(ContextBackoffHelper); ok {
+			againErr = ch.AgainContext(ctx)
+		} else if h.Again() {
+			againErr = nil
+		}
+		if againErr != nil && config.budget != nil {
+			config.budget.refund()
+		}
+		if againErr != nil {
+			return rv, giveUp(againErr)
 		}
-		rv, err = f()
+		rv, err = f(ctx)
 	}
 
 	return rv, nil
@@ -1,7 +1,10 @@
 package backoff
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"testing"
@@ -162,7 +165,7 @@ func TestCallWithBackoff(t *testing.T) {
 	if t2.attempts != 6 {
 		t.Errorf("Unexpected number of calls, saw %d want 6", t2.attempts)
 	}
-	if err != RetriesExhausted {
+	if !errors.Is(err, RetriesExhausted) {
 		t.Errorf("Unexpected error, %v, expected RetriesExhausted", err)
 	}
 
@@ -184,3 +187,285 @@ func TestCallWithBackoff(t *testing.T) {
 	}
 
 }
+
+func TestAgainContext(t *testing.T) {
+	e := NewExponential().SetInitialDelay(time.Second).SetJitter(time.Millisecond).SetRetries(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := e.AgainContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Want context.Canceled, saw %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	before := time.Now()
+	err := e.AgainContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Want context.DeadlineExceeded, saw %v", err)
+	}
+	if slept := time.Since(before); slept > 10*time.Millisecond {
+		t.Errorf("Slept %v, despite the deadline being before the next attempt", slept)
+	}
+	if e.currentTries != 0 {
+		t.Errorf("Aborted attempt was counted")
+	}
+
+	e.SetInitialDelay(time.Millisecond)
+	if err := e.AgainContext(context.Background()); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := e.AgainContext(context.Background()); err != RetriesExhausted {
+		t.Errorf("Want RetriesExhausted, saw %v", err)
+	}
+}
+
+func TestCallWithHelperContext(t *testing.T) {
+	helper := NewExponential().SetInitialDelay(200 * time.Millisecond).SetJitter(time.Millisecond).SetRetries(5)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	before := time.Now()
+	v, err := CallWithHelperContext(ctx, helper, func(ctx context.Context) (int, error) {
+		calls++
+		return calls, errors.New("blah")
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Want context.Canceled, saw %v", err)
+	}
+	if v != 1 || calls != 1 {
+		t.Errorf("Want 1 call returning 1, saw %d calls returning %d", calls, v)
+	}
+	if elapsed := time.Since(before); elapsed > 150*time.Millisecond {
+		t.Errorf("Kept sleeping %v after the context was cancelled", elapsed)
+	}
+}
+
+type statusError struct {
+	code int
+}
+
+func (s *statusError) Error() string {
+	return fmt.Sprintf("status %d", s.code)
+}
+
+func TestRetryError(t *testing.T) {
+	helper := NewExponential().SetInitialDelay(time.Millisecond).SetJitter(time.Millisecond).SetRetries(2)
+	first := errors.New("first")
+
+	calls := 0
+	_, err := CallWithHelper(helper, func() (int, error) {
+		calls++
+		if calls == 1 {
+			return 0, first
+		}
+		return 0, &statusError{500 + calls}
+	})
+
+	var re *RetryError
+	if !errors.As(err, &re) {
+		t.Fatalf("Want a *RetryError, saw %v", err)
+	}
+	if re.Attempts != 3 || len(re.Errors) != 3 {
+		t.Errorf("Want 3 attempts and errors, saw %d and %d", re.Attempts, len(re.Errors))
+	}
+	if re.Elapsed <= 0 {
+		t.Errorf("Elapsed time not recorded")
+	}
+	if !errors.Is(err, RetriesExhausted) {
+		t.Errorf("Error does not match RetriesExhausted")
+	}
+	if !errors.Is(err, first) {
+		t.Errorf("Error does not match an earlier error")
+	}
+
+	var se *statusError
+	if !errors.As(err, &se) || se.code != 503 {
+		t.Errorf("Want the last status error (503), saw %v", se)
+	}
+	if errors.Unwrap(err) != re.Last() {
+		t.Errorf("Error does not unwrap to the last error")
+	}
+	if !strings.Contains(err.Error(), "status 503") {
+		t.Errorf("Error message lacks the last error, saw %s", err)
+	}
+}
+
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func (f *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.sleeps = append(f.sleeps, d)
+	f.now = f.now.Add(d)
+	return nil
+}
+
+func TestMaxDelay(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	helper := NewExponential().SetInitialDelay(time.Second).SetJitter(time.Nanosecond).SetRetries(20).SetMaxDelay(10 * time.Second).SetClock(clock)
+
+	for helper.Again() {
+	}
+
+	if len(clock.sleeps) != 20 {
+		t.Fatalf("Want 20 sleeps, saw %d", len(clock.sleeps))
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}
+	for ix, w := range want {
+		if got := clock.sleeps[ix]; got != w {
+			t.Errorf("Sleep #%d, want %v, saw %v", ix, w, got)
+		}
+	}
+	for ix, got := range clock.sleeps[len(want):] {
+		if got != 10*time.Second {
+			t.Errorf("Sleep #%d, want %v, saw %v", ix+len(want), 10*time.Second, got)
+		}
+	}
+}
+
+func TestMaxElapsed(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	helper := NewExponential().SetInitialDelay(time.Second).SetJitter(time.Nanosecond).SetRetries(20).SetMaxElapsed(20 * time.Second).SetClock(clock)
+
+	// Sleeps of 1, 2, 4 and 8 seconds add up to 15, the next sleep
+	// of 16 would go over budget.
+	tries := 0
+	for helper.Again() {
+		tries++
+	}
+	if tries != 4 {
+		t.Errorf("Want 4 tries, saw %d", tries)
+	}
+	if err := helper.AgainContext(context.Background()); err != RetriesExhausted {
+		t.Errorf("Want RetriesExhausted, saw %v", err)
+	}
+
+	// Time passing between attempts counts against the budget.
+	helper.Reset()
+	clock.sleeps = nil
+	if !helper.Again() {
+		t.Fatalf("Again after Reset failed")
+	}
+	clock.now = clock.now.Add(18 * time.Second)
+	if helper.Again() {
+		t.Errorf("Unexpected success, after %v", clock.sleeps)
+	}
+	if len(clock.sleeps) != 1 {
+		t.Errorf("Want 1 sleep, saw %d", len(clock.sleeps))
+	}
+}
+
+func TestMaxElapsedFirstCall(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	helper := NewExponential().SetInitialDelay(time.Second).SetJitter(time.Nanosecond).SetMaxElapsed(5 * time.Second).SetClock(clock)
+
+	// The first call alone takes longer than the whole budget, so
+	// there is no time left for a retry.
+	calls := 0
+	_, err := CallWithHelper(helper, func() (int, error) {
+		calls++
+		clock.now = clock.now.Add(6 * time.Second)
+		return 0, errors.New("slow failure")
+	})
+	if calls != 1 {
+		t.Errorf("Want 1 call, saw %d", calls)
+	}
+	if !errors.Is(err, RetriesExhausted) {
+		t.Errorf("Want RetriesExhausted, saw %v", err)
+	}
+	if len(clock.sleeps) != 0 {
+		t.Errorf("Unexpected sleeps %v", clock.sleeps)
+	}
+}
+
+func TestNextBackOff(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	e := NewExponential().SetInitialDelay(time.Second).SetJitter(time.Nanosecond).SetRetries(4).SetMaxDelay(3 * time.Second).SetClock(clock)
+
+	var h DelayBackoffHelper = e
+	want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}
+	for ix, w := range want {
+		d, ok := h.NextBackOff()
+		if !ok || d != w {
+			t.Errorf("Delay #%d, want %v, saw %v (%v)", ix, w, d, ok)
+		}
+	}
+	if d, ok := h.NextBackOff(); ok {
+		t.Errorf("Unexpected delay %v after running out of attempts", d)
+	}
+	if len(clock.sleeps) != 0 {
+		t.Errorf("NextBackOff slept %v", clock.sleeps)
+	}
+	if h.Again() {
+		t.Errorf("Again succeeded after running out of attempts")
+	}
+
+	// The elapsed time budget is measured with the clock, even when
+	// the caller does the waiting.
+	e.Reset().SetMaxElapsed(5 * time.Second)
+	if _, ok := e.NextBackOff(); !ok {
+		t.Fatalf("NextBackOff failed after Reset")
+	}
+	clock.now = clock.now.Add(4 * time.Second)
+	if d, ok := e.NextBackOff(); ok {
+		t.Errorf("Unexpected delay %v past the elapsed time budget", d)
+	}
+
+	for _, s := range []DelayBackoffHelper{NewConstant(time.Second), NewLinear(time.Second, time.Second), NewFibonacci(time.Second)} {
+		if d, ok := s.NextBackOff(); !ok || d != time.Second {
+			t.Errorf("%T, want 1s, saw %v (%v)", s, d, ok)
+		}
+	}
+}
+
+func TestCallWithHelperContextKeepsErrors(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	helper := NewConstant(time.Second).SetRetries(10).SetClock(clock)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	_, err := CallWithHelperContext(ctx, helper, func(ctx context.Context) (int, error) {
+		calls++
+		if calls == 3 {
+			cancel()
+		}
+		return 0, &statusError{code: 500 + calls}
+	})
+
+	var re *RetryError
+	if !errors.As(err, &re) {
+		t.Fatalf("Want a RetryError, saw %v", err)
+	}
+	if !errors.Is(err, context.Canceled) || errors.Is(err, RetriesExhausted) {
+		t.Errorf("Want context.Canceled as the reason, saw %v", err)
+	}
+	if re.Attempts != 3 || len(re.Errors) != 3 {
+		t.Errorf("Want 3 attempts and errors, saw %d and %v", re.Attempts, re.Errors)
+	}
+	var se *statusError
+	if !errors.As(err, &se) || se.code != 503 {
+		t.Errorf("Want the last status error, saw %v", se)
+	}
+	// Two sleeps of a second each, on the helper's clock.
+	if re.Elapsed != 2*time.Second {
+		t.Errorf("Want 2s elapsed, saw %v", re.Elapsed)
+	}
+	if !strings.Contains(err.Error(), "status 503") {
+		t.Errorf("Error message %q lacks the cause", err)
+	}
+}
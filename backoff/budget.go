@@ -0,0 +1,130 @@
+package backoff
+
+import (
+	"sync"
+	"time"
+)
+
+// The number of retries a Budget holds on to, by default.
+const DefaultBudgetBurst = 100.0
+
+// Allow for rounding, so that ten deposits of 0.1 do add up to a
+// retry.
+const budgetSlack = 1e-9
+
+// A retry budget, shared between callers, to stop retries from
+// multiplying the load on a service that is already failing. Every
+// request adds ratio tokens to the budget, every retry takes one, and
+// on top of that, minPerSecond tokens trickle in every second so that
+// rarely used callers can still retry. The budget starts full, and
+// holds at most the burst size.
+//
+// A Budget is safe for concurrent use.
+type Budget struct {
+	lock         sync.Mutex
+	ratio        float64
+	minPerSecond float64
+	burst        float64
+	tokens       float64
+	last         time.Time
+	clock        Clock
+}
+
+// Create a retry budget, allowing retries to be ratio of the requests
+// made (so 0.1 for 10%), plus minPerSecond retries per second.
+func NewBudget(ratio, minPerSecond float64) *Budget {
+	b := Budget{
+		ratio:        ratio,
+		minPerSecond: minPerSecond,
+		burst:        DefaultBudgetBurst,
+		tokens:       DefaultBudgetBurst,
+		clock:        realClock{},
+	}
+	b.last = b.clock.Now()
+
+	return &b
+}
+
+// Set the most retries the budget can hold. If the budget currently
+// holds more, it is emptied down to the new size.
+func (b *Budget) SetBurst(n float64) *Budget {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.burst = n
+	if b.tokens > n {
+		b.tokens = n
+	}
+
+	return b
+}
+
+// Set the clock used to top up the budget over time.
+func (b *Budget) SetClock(c Clock) *Budget {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.clock = c
+	b.last = c.Now()
+
+	return b
+}
+
+// Add the tokens trickling in since the last top-up. Must be called
+// with the lock held.
+func (b *Budget) refill() {
+	now := b.clock.Now()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.add(elapsed.Seconds() * b.minPerSecond)
+	}
+	b.last = now
+}
+
+func (b *Budget) add(n float64) {
+	b.tokens += n
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Record a request, adding its share of retries to the budget.
+func (b *Budget) Deposit() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill()
+	b.add(b.ratio)
+}
+
+// Take a retry from the budget, returning false (and taking nothing)
+// if there is not a whole retry left.
+func (b *Budget) Withdraw() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill()
+	if b.tokens < 1-budgetSlack {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// Put back a retry that was withdrawn, but never made.
+func (b *Budget) refund() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.add(1)
+}
+
+// Share a retry budget between calls. Each call deposits into the
+// budget, and each retry withdraws from it. Once the budget is
+// exhausted, CallWithHelper stops with a *RetryError matching
+// BudgetExhausted.
+func WithBudget(b *Budget) CallOption {
+	return func(c *callConfig) {
+		c.budget = b
+	}
+}
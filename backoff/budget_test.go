@@ -0,0 +1,127 @@
+package backoff
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBudgetRatio(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	b := NewBudget(0.1, 0).SetBurst(5).SetClock(clock)
+
+	// The budget starts full.
+	for i := 0; i < 5; i++ {
+		if !b.Withdraw() {
+			t.Fatalf("Withdrawal #%d failed from a full budget", i)
+		}
+	}
+	if b.Withdraw() {
+		t.Errorf("Withdrew from an empty budget")
+	}
+
+	// Ten requests pay for one retry.
+	for i := 0; i < 9; i++ {
+		b.Deposit()
+	}
+	if b.Withdraw() {
+		t.Errorf("Withdrew after only 9 requests")
+	}
+	b.Deposit()
+	if !b.Withdraw() {
+		t.Errorf("Failed to withdraw after 10 requests")
+	}
+
+	// Deposits stop at the burst size.
+	for i := 0; i < 1000; i++ {
+		b.Deposit()
+	}
+	for i := 0; i < 5; i++ {
+		b.Withdraw()
+	}
+	if b.Withdraw() {
+		t.Errorf("Budget held more than its burst size")
+	}
+}
+
+func TestBudgetMinRate(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	b := NewBudget(0, 2).SetBurst(1).SetClock(clock)
+
+	if !b.Withdraw() || b.Withdraw() {
+		t.Fatalf("Want exactly one retry from a burst of 1")
+	}
+	clock.now = clock.now.Add(400 * time.Millisecond)
+	if b.Withdraw() {
+		t.Errorf("Withdrew after 0.8 retries trickled in")
+	}
+	clock.now = clock.now.Add(100 * time.Millisecond)
+	if !b.Withdraw() {
+		t.Errorf("Failed to withdraw after a retry trickled in")
+	}
+}
+
+func TestCallWithBudget(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	b := NewBudget(0.1, 0).SetBurst(3).SetClock(clock)
+	failing := errors.New("failing")
+
+	calls := 0
+	_, err := CallWithHelper(NewConstant(time.Second).SetRetries(5).SetClock(clock), func() (int, error) {
+		calls++
+		return 0, failing
+	}, WithBudget(b))
+
+	if calls != 4 {
+		t.Errorf("Want 4 calls, saw %d", calls)
+	}
+	if !errors.Is(err, BudgetExhausted) || errors.Is(err, RetriesExhausted) {
+		t.Errorf("Want BudgetExhausted, saw %v", err)
+	}
+	if !errors.Is(err, failing) {
+		t.Errorf("Want the function's error to be kept, saw %v", err)
+	}
+	var re *RetryError
+	if !errors.As(err, &re) || re.Attempts != 4 {
+		t.Errorf("Want a RetryError after 4 attempts, saw %v", err)
+	}
+
+	// A helper running out of attempts hands its retry back.
+	b = NewBudget(0, 0).SetBurst(2).SetClock(clock)
+	_, err = CallWithHelper(NewConstant(time.Second).SetRetries(1).SetClock(clock), func() (int, error) {
+		return 0, failing
+	}, WithBudget(b))
+	if !errors.Is(err, RetriesExhausted) {
+		t.Errorf("Want RetriesExhausted, saw %v", err)
+	}
+	if !b.Withdraw() {
+		t.Errorf("Unused retry was not refunded")
+	}
+}
+
+func TestBudgetConcurrent(t *testing.T) {
+	b := NewBudget(0, 0).SetBurst(50)
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	granted := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if b.Withdraw() {
+					lock.Lock()
+					granted++
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if granted != 50 {
+		t.Errorf("Want 50 retries granted, saw %d", granted)
+	}
+}
@@ -0,0 +1,119 @@
+package backoff
+
+// Deciding which errors are worth retrying.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Wraps an error, to stop CallWithHelper from retrying while keeping
+// the original error.
+type PermanentError struct {
+	Err error
+}
+
+func (p *PermanentError) Error() string {
+	return p.Err.Error()
+}
+
+func (p *PermanentError) Unwrap() error {
+	return p.Err
+}
+
+// Mark an error as permanent. When returned from a function called
+// by CallWithHelper, there are no further attempts, and the original
+// error is returned. Permanent(nil) is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &PermanentError{Err: err}
+}
+
+// A Retryable classifier returns true if an error is worth retrying.
+type Retryable func(error) bool
+
+// Options for CallWithHelper and CallWithHelperContext.
+type CallOption func(*callConfig)
+
+type callConfig struct {
+	retryable Retryable
+	budget    *Budget
+}
+
+// Only retry errors the classifier considers retryable. Errors that
+// are not retryable are returned as-is, without further attempts.
+func WithRetryable(r Retryable) CallOption {
+	return func(c *callConfig) {
+		c.retryable = r
+	}
+}
+
+// Combine classifiers, retrying only errors all of them consider
+// retryable.
+func AllRetryable(rs ...Retryable) Retryable {
+	return func(err error) bool {
+		for _, r := range rs {
+			if !r(err) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Retry only network timeouts.
+func RetryNetTimeouts(err error) bool {
+	var ne net.Error
+
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// Retry anything but context cancellation and deadlines.
+func RetryUnlessContext(err error) bool {
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// An error for an unsuccessful HTTP response.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (h *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %s", h.Status)
+}
+
+// Return an *HTTPStatusError for responses with a 4xx or 5xx status,
+// otherwise nil.
+func CheckHTTPStatus(resp *http.Response) error {
+	if resp.StatusCode < 400 {
+		return nil
+	}
+
+	return &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+}
+
+// Retry server errors (5xx), as well as 408 Request Timeout and 429
+// Too Many Requests, but no other client errors (4xx). Errors that
+// are not an *HTTPStatusError are considered retryable.
+func RetryHTTPStatus(err error) bool {
+	var he *HTTPStatusError
+	if !errors.As(err, &he) {
+		return true
+	}
+
+	switch {
+	case he.StatusCode >= 500:
+		return true
+	case he.StatusCode == http.StatusRequestTimeout, he.StatusCode == http.StatusTooManyRequests:
+		return true
+	}
+
+	return false
+}
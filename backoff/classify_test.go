@@ -0,0 +1,118 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type timeoutError struct {
+	timeout bool
+}
+
+func (t timeoutError) Error() string   { return "net error" }
+func (t timeoutError) Timeout() bool   { return t.timeout }
+func (t timeoutError) Temporary() bool { return false }
+
+var _ net.Error = timeoutError{}
+
+func TestClassifiers(t *testing.T) {
+	plain := errors.New("plain")
+	timeout := fmt.Errorf("wrapped: %w", timeoutError{true})
+
+	cases := []struct {
+		name string
+		r    Retryable
+		err  error
+		want bool
+	}{
+		{"net timeout", RetryNetTimeouts, timeout, true},
+		{"net non-timeout", RetryNetTimeouts, timeoutError{false}, false},
+		{"net plain", RetryNetTimeouts, plain, false},
+		{"context canceled", RetryUnlessContext, fmt.Errorf("x: %w", context.Canceled), false},
+		{"context deadline", RetryUnlessContext, context.DeadlineExceeded, false},
+		{"context plain", RetryUnlessContext, plain, true},
+		{"http 500", RetryHTTPStatus, &HTTPStatusError{StatusCode: 500}, true},
+		{"http 503", RetryHTTPStatus, &HTTPStatusError{StatusCode: 503}, true},
+		{"http 429", RetryHTTPStatus, &HTTPStatusError{StatusCode: 429}, true},
+		{"http 408", RetryHTTPStatus, &HTTPStatusError{StatusCode: 408}, true},
+		{"http 404", RetryHTTPStatus, &HTTPStatusError{StatusCode: 404}, false},
+		{"http plain", RetryHTTPStatus, plain, true},
+		{"all", AllRetryable(RetryUnlessContext, RetryHTTPStatus), &HTTPStatusError{StatusCode: 400}, false},
+		{"all ok", AllRetryable(RetryUnlessContext, RetryHTTPStatus), plain, true},
+	}
+
+	for ix, tc := range cases {
+		if got := tc.r(tc.err); got != tc.want {
+			t.Errorf("Case #%d (%s), want %v, saw %v", ix, tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestCheckHTTPStatus(t *testing.T) {
+	if err := CheckHTTPStatus(&http.Response{StatusCode: 204, Status: "204 No Content"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	err := CheckHTTPStatus(&http.Response{StatusCode: 502, Status: "502 Bad Gateway"})
+	var he *HTTPStatusError
+	if !errors.As(err, &he) || he.StatusCode != 502 {
+		t.Errorf("Want a 502 HTTPStatusError, saw %v", err)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	if Permanent(nil) != nil {
+		t.Errorf("Permanent(nil) is not nil")
+	}
+
+	helper := NewExponential().SetInitialDelay(time.Millisecond).SetJitter(time.Millisecond).SetRetries(5)
+	original := errors.New("bad request")
+
+	calls := 0
+	_, err := CallWithHelper(helper, func() (int, error) {
+		calls++
+		return 0, Permanent(original)
+	})
+	if calls != 1 {
+		t.Errorf("Want 1 call, saw %d", calls)
+	}
+	if err != original {
+		t.Errorf("Want the original error, saw %v", err)
+	}
+
+	helper.Reset()
+	calls = 0
+	_, err = CallWithHelper(helper, func() (int, error) {
+		calls++
+		return 0, fmt.Errorf("context: %w", Permanent(original))
+	})
+	if calls != 1 || !errors.Is(err, original) {
+		t.Errorf("Want 1 call and the original error, saw %d and %v", calls, err)
+	}
+}
+
+func TestWithRetryable(t *testing.T) {
+	helper := NewExponential().SetInitialDelay(time.Millisecond).SetJitter(time.Millisecond).SetRetries(5)
+
+	calls := 0
+	_, err := CallWithHelper(helper, func() (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, &HTTPStatusError{StatusCode: 503, Status: "503 Service Unavailable"}
+		}
+		return 0, &HTTPStatusError{StatusCode: 404, Status: "404 Not Found"}
+	}, WithRetryable(RetryHTTPStatus))
+
+	var he *HTTPStatusError
+	if !errors.As(err, &he) || he.StatusCode != 404 {
+		t.Errorf("Want the 404 error, saw %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Want 3 calls, saw %d", calls)
+	}
+}
@@ -0,0 +1,64 @@
+package backoff
+
+import (
+	"time"
+)
+
+// What a JitterStrategy gets to work from when picking the next delay.
+type JitterInput struct {
+	// The exponential delay without any jitter, that is, the
+	// initial delay multiplied by the scale factor once per
+	// attempt made so far, clamped to the maximum delay.
+	Base time.Duration
+	// The previous delay returned, zero before the first attempt.
+	Previous time.Duration
+	// The helper's initial delay, jitter and scale factor.
+	Initial time.Duration
+	Jitter  time.Duration
+	Scale   float64
+	// Where to draw random numbers from, the global source if nil.
+	Rand Rand
+}
+
+// A JitterStrategy computes the next delay of an Exponential helper.
+// The result is clamped to the helper's maximum delay, if set.
+type JitterStrategy func(in JitterInput) time.Duration
+
+// The default strategy. The first delay is the initial delay plus up
+// to the jitter, every following delay is the previous delay scaled,
+// plus up to the jitter. Since the jitter is carried forward, it
+// compounds over the attempts.
+func AdditiveJitter(in JitterInput) time.Duration {
+	if in.Previous == 0 {
+		return in.Initial + randomDuration(in.Rand, in.Jitter)
+	}
+
+	return time.Duration(float64(in.Previous)*in.Scale) + randomDuration(in.Rand, in.Jitter)
+}
+
+// A delay picked uniformly in [0, Base). This spreads synchronised
+// callers out the most, at the cost of sometimes retrying almost
+// immediately.
+func FullJitter(in JitterInput) time.Duration {
+	return randomDuration(in.Rand, in.Base)
+}
+
+// A delay picked uniformly in [Base/2, Base), keeping at least half
+// the exponential delay.
+func EqualJitter(in JitterInput) time.Duration {
+	half := in.Base / 2
+
+	return half + randomDuration(in.Rand, in.Base-half)
+}
+
+// A delay picked uniformly in [Initial, 3*Previous), growing from the
+// previous delay rather than from the attempt count. The first delay
+// is picked as if the previous one was the initial delay.
+func DecorrelatedJitter(in JitterInput) time.Duration {
+	prev := in.Previous
+	if prev < in.Initial {
+		prev = in.Initial
+	}
+
+	return in.Initial + randomDuration(in.Rand, 3*prev-in.Initial)
+}
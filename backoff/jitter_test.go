@@ -0,0 +1,92 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitterBounds(t *testing.T) {
+	in := JitterInput{
+		Base:     800 * time.Millisecond,
+		Previous: 500 * time.Millisecond,
+		Initial:  100 * time.Millisecond,
+		Jitter:   50 * time.Millisecond,
+		Scale:    2.0,
+	}
+	first := in
+	first.Previous = 0
+	first.Base = in.Initial
+
+	cases := []struct {
+		name      string
+		s         JitterStrategy
+		in        JitterInput
+		low, high time.Duration
+	}{
+		{"additive first", AdditiveJitter, first, 100 * time.Millisecond, 150 * time.Millisecond},
+		{"additive", AdditiveJitter, in, time.Second, 1050 * time.Millisecond},
+		{"full", FullJitter, in, 0, 800 * time.Millisecond},
+		{"equal", EqualJitter, in, 400 * time.Millisecond, 800 * time.Millisecond},
+		{"decorrelated first", DecorrelatedJitter, first, 100 * time.Millisecond, 300 * time.Millisecond},
+		{"decorrelated", DecorrelatedJitter, in, 100 * time.Millisecond, 1500 * time.Millisecond},
+	}
+
+	for _, tc := range cases {
+		var min, max time.Duration = tc.high, tc.low
+		for i := 0; i < 2000; i++ {
+			d := tc.s(tc.in)
+			if d < tc.low || d >= tc.high {
+				t.Fatalf("%s: delay %v outside [%v, %v)", tc.name, d, tc.low, tc.high)
+			}
+			if d < min {
+				min = d
+			}
+			if d > max {
+				max = d
+			}
+		}
+		// The delays should cover most of the range, not sit in
+		// one corner of it.
+		spread := (tc.high - tc.low) / 10
+		if min > tc.low+spread || max < tc.high-spread {
+			t.Errorf("%s: delays in [%v, %v] do not cover [%v, %v)", tc.name, min, max, tc.low, tc.high)
+		}
+	}
+}
+
+func TestJitterStrategyCapped(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	e := NewExponential().SetInitialDelay(time.Second).SetRetries(10).SetMaxDelay(5 * time.Second).SetJitterStrategy(FullJitter).SetClock(clock)
+
+	for e.Again() {
+	}
+
+	if len(clock.sleeps) != 10 {
+		t.Fatalf("Want 10 sleeps, saw %d", len(clock.sleeps))
+	}
+	for ix, d := range clock.sleeps {
+		base := time.Second << ix
+		if base > 5*time.Second {
+			base = 5 * time.Second
+		}
+		if d < 0 || d >= base {
+			t.Errorf("Sleep #%d, want in [0, %v), saw %v", ix, base, d)
+		}
+	}
+}
+
+func TestDecorrelatedGrows(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	e := NewExponential().SetInitialDelay(time.Second).SetRetries(20).SetMaxDelay(time.Minute).SetJitterStrategy(DecorrelatedJitter).SetClock(clock)
+
+	for e.Again() {
+	}
+
+	prev := time.Second
+	for ix, d := range clock.sleeps {
+		if d < time.Second || d > time.Minute || d >= 3*prev {
+			t.Errorf("Sleep #%d, want in [1s, min(1m, %v)), saw %v", ix, 3*prev, d)
+		}
+		prev = d
+	}
+}
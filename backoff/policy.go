@@ -0,0 +1,66 @@
+package backoff
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// A source of random numbers for jitter. As a Rand may be shared
+// between helpers, implementations must be safe for concurrent use.
+type Rand interface {
+	Int63n(n int64) int64
+}
+
+// The math/rand global source, which does its own locking.
+type globalRand struct{}
+
+func (globalRand) Int63n(n int64) int64 {
+	return rand.Int63n(n)
+}
+
+type lockedRand struct {
+	lock sync.Mutex
+	r    *rand.Rand
+}
+
+func (l *lockedRand) Int63n(n int64) int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.r.Int63n(n)
+}
+
+// Create a Rand, safe for concurrent use, from a seed. Helpers using
+// Rands created from the same seed, in the same order, get the same
+// delays, which is mostly useful for tests.
+func NewLockedRand(seed int64) Rand {
+	return &lockedRand{r: rand.New(rand.NewSource(seed))}
+}
+
+// An immutable exponential backoff policy. Unlike an Exponential, a
+// policy can be shared between goroutines, with every backoff session
+// getting its own helper from Start.
+//
+// The clock and Rand of the helper the policy was made from are
+// shared by all helpers started from it, so they must be safe for
+// concurrent use. The defaults are.
+type ExponentialPolicy struct {
+	proto Exponential
+}
+
+// Capture the settings of a helper as a policy. Later changes to the
+// helper do not affect the policy.
+func (e *Exponential) Policy() *ExponentialPolicy {
+	p := ExponentialPolicy{proto: *e}
+	p.proto.reset()
+
+	return &p
+}
+
+// Return a fresh helper, with no attempts made, following this policy.
+func (p *ExponentialPolicy) Start() *Exponential {
+	e := p.proto
+	e.firstDelay()
+
+	return &e
+}
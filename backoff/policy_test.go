@@ -0,0 +1,89 @@
+package backoff
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockedRandReproducible(t *testing.T) {
+	delays := func() []time.Duration {
+		e := NewExponential().SetRand(NewLockedRand(42)).SetRetries(5).SetJitterStrategy(FullJitter)
+		var rv []time.Duration
+		for {
+			d, ok := e.NextBackOff()
+			if !ok {
+				return rv
+			}
+			rv = append(rv, d)
+		}
+	}
+
+	first := delays()
+	second := delays()
+	if len(first) != 5 || len(second) != 5 {
+		t.Fatalf("Want 5 delays, saw %d and %d", len(first), len(second))
+	}
+	for ix := range first {
+		if first[ix] != second[ix] {
+			t.Errorf("Delay #%d, %v != %v", ix, first[ix], second[ix])
+		}
+	}
+}
+
+func TestPolicyStart(t *testing.T) {
+	e := NewExponential().SetInitialDelay(time.Second).SetJitter(time.Nanosecond).SetRetries(3)
+	e.NextBackOff()
+	p := e.Policy()
+
+	// Changing the helper afterwards leaves the policy alone.
+	e.SetRetries(10)
+
+	for round := 0; round < 2; round++ {
+		h := p.Start()
+		var got []time.Duration
+		for {
+			d, ok := h.NextBackOff()
+			if !ok {
+				break
+			}
+			got = append(got, d)
+		}
+		want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+		if len(got) != len(want) {
+			t.Fatalf("Round %d, want %v, saw %v", round, want, got)
+		}
+		for ix := range want {
+			if got[ix] != want[ix] {
+				t.Errorf("Round %d, delay #%d, want %v, saw %v", round, ix, want[ix], got[ix])
+			}
+		}
+	}
+}
+
+func TestPolicyConcurrent(t *testing.T) {
+	p := NewExponential().SetInitialDelay(time.Millisecond).SetJitter(time.Millisecond).SetRand(NewLockedRand(1)).SetRetries(10).Policy()
+
+	var wg sync.WaitGroup
+	counts := make([]int, 20)
+	for i := range counts {
+		wg.Add(1)
+		go func(ix int) {
+			defer wg.Done()
+			h := p.Start()
+			for {
+				if _, ok := h.NextBackOff(); !ok {
+					return
+				}
+				counts[ix]++
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for ix, c := range counts {
+		if c != 10 {
+			t.Errorf("Goroutine #%d, want 10 attempts, saw %d", ix, c)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package backoff
+
+import (
+	"context"
+	"time"
+)
+
+// A backoff helper that waits the same time, plus some random jitter,
+// between every attempt.
+type Constant struct {
+	attempts
+	delay     time.Duration
+	jitter    time.Duration
+	nextDelay time.Duration
+}
+
+// A backoff helper where the delay grows by the same step for every
+// attempt, plus some random jitter.
+type Linear struct {
+	attempts
+	initialDelay time.Duration
+	step         time.Duration
+	jitter       time.Duration
+	nextDelay    time.Duration
+}
+
+// A backoff helper where the delays follow the Fibonacci sequence,
+// 1, 1, 2, 3, 5, 8... times a unit delay, plus some random
+// jitter. This grows slower than doubling, but still faster than any
+// linear backoff.
+type Fibonacci struct {
+	attempts
+	unit      time.Duration
+	jitter    time.Duration
+	prev      time.Duration
+	cur       time.Duration
+	nextDelay time.Duration
+}
+
+// Create a constant backoff helper, sleeping delay between attempts.
+// It defaults to 5 tries and no jitter.
+func NewConstant(delay time.Duration) *Constant {
+	c := Constant{attempts: newAttempts(), delay: delay}
+	c.nextDelay = c.jittered()
+
+	return &c
+}
+
+func (c *Constant) jittered() time.Duration {
+	return c.delay + randomDuration(c.rand, c.jitter)
+}
+
+func (c *Constant) updateDelay() {
+	c.nextDelay = c.jittered()
+}
+
+// Try another backoff step, sleeping the constant delay, plus up to
+// the jitter. This returns false once the attempts have run out.
+func (c *Constant) Again() bool {
+	return c.AgainContext(context.Background()) == nil
+}
+
+// Try another backoff step, giving up if the context is done, as
+// described for Exponential.AgainContext.
+func (c *Constant) AgainContext(ctx context.Context) error {
+	return c.wait(ctx, c.nextDelay, c.NextBackOff)
+}
+
+// Return the next delay and count it as an attempt, without
+// sleeping. This returns false once the attempts have run out.
+func (c *Constant) NextBackOff() (time.Duration, bool) {
+	return c.next(c.nextDelay, c.updateDelay)
+}
+
+// Set the maximum number of tries for a helper.
+func (c *Constant) SetRetries(n int32) *Constant {
+	c.maxTries = n
+
+	return c
+}
+
+// Set the maximum amount of jitter added to each delay.
+func (c *Constant) SetJitter(dt time.Duration) *Constant {
+	c.jitter = dt
+	c.nextDelay = c.jittered()
+
+	return c
+}
+
+// Set the clock used to measure elapsed time and to sleep.
+func (c *Constant) SetClock(clock Clock) *Constant {
+	c.clock = clock
+
+	return c
+}
+
+// Set the source of randomness for the jitter.
+func (c *Constant) SetRand(rnd Rand) *Constant {
+	c.rand = rnd
+	c.nextDelay = c.jittered()
+
+	return c
+}
+
+// Reset a helper to "no tries".
+func (c *Constant) Reset() *Constant {
+	c.reset()
+	c.nextDelay = c.jittered()
+
+	return c
+}
+
+// Create a linear backoff helper, where the first delay is
+// initialDelay and every following delay is step longer than the
+// one before. It defaults to 5 tries and no jitter.
+func NewLinear(initialDelay, step time.Duration) *Linear {
+	l := Linear{attempts: newAttempts(), initialDelay: initialDelay, step: step}
+	l.nextDelay = l.jittered()
+
+	return &l
+}
+
+// The delay for the attempt after the ones made so far.
+func (l *Linear) jittered() time.Duration {
+	return l.initialDelay + time.Duration(l.currentTries)*l.step + randomDuration(l.rand, l.jitter)
+}
+
+func (l *Linear) updateDelay() {
+	l.nextDelay = l.jittered()
+}
+
+// Try another backoff step, sleeping a step longer than last time,
+// plus up to the jitter. This returns false once the attempts have
+// run out.
+func (l *Linear) Again() bool {
+	return l.AgainContext(context.Background()) == nil
+}
+
+// Try another backoff step, giving up if the context is done, as
+// described for Exponential.AgainContext.
+func (l *Linear) AgainContext(ctx context.Context) error {
+	return l.wait(ctx, l.nextDelay, l.NextBackOff)
+}
+
+// Return the next delay and count it as an attempt, without
+// sleeping. This returns false once the attempts have run out.
+func (l *Linear) NextBackOff() (time.Duration, bool) {
+	return l.next(l.nextDelay, l.updateDelay)
+}
+
+// Set the maximum number of tries for a helper.
+func (l *Linear) SetRetries(n int32) *Linear {
+	l.maxTries = n
+
+	return l
+}
+
+// Set the maximum amount of jitter added to each delay. The jitter is
+// not carried forward to the following delays.
+func (l *Linear) SetJitter(dt time.Duration) *Linear {
+	l.jitter = dt
+	l.nextDelay = l.jittered()
+
+	return l
+}
+
+// Set the clock used to measure elapsed time and to sleep.
+func (l *Linear) SetClock(clock Clock) *Linear {
+	l.clock = clock
+
+	return l
+}
+
+// Set the source of randomness for the jitter.
+func (l *Linear) SetRand(rnd Rand) *Linear {
+	l.rand = rnd
+	l.nextDelay = l.jittered()
+
+	return l
+}
+
+// Reset a helper to "no tries, next delay will be initial delay plus
+// some random jitter".
+func (l *Linear) Reset() *Linear {
+	l.reset()
+	l.nextDelay = l.jittered()
+
+	return l
+}
+
+// Create a Fibonacci backoff helper, where the first two delays are
+// unit, and every following delay is the sum of the two before
+// it. It defaults to 5 tries and no jitter.
+func NewFibonacci(unit time.Duration) *Fibonacci {
+	f := Fibonacci{attempts: newAttempts(), unit: unit}
+	f.first()
+
+	return &f
+}
+
+func (f *Fibonacci) first() {
+	f.prev = 0
+	f.cur = f.unit
+	f.nextDelay = f.cur + randomDuration(f.rand, f.jitter)
+}
+
+func (f *Fibonacci) updateDelay() {
+	f.prev, f.cur = f.cur, f.prev+f.cur
+	f.nextDelay = f.cur + randomDuration(f.rand, f.jitter)
+}
+
+// Try another backoff step, sleeping the next Fibonacci number of
+// units, plus up to the jitter. This returns false once the attempts
+// have run out.
+func (f *Fibonacci) Again() bool {
+	return f.AgainContext(context.Background()) == nil
+}
+
+// Try another backoff step, giving up if the context is done, as
+// described for Exponential.AgainContext.
+func (f *Fibonacci) AgainContext(ctx context.Context) error {
+	return f.wait(ctx, f.nextDelay, f.NextBackOff)
+}
+
+// Return the next delay and count it as an attempt, without
+// sleeping. This returns false once the attempts have run out.
+func (f *Fibonacci) NextBackOff() (time.Duration, bool) {
+	return f.next(f.nextDelay, f.updateDelay)
+}
+
+// Set the maximum number of tries for a helper.
+func (f *Fibonacci) SetRetries(n int32) *Fibonacci {
+	f.maxTries = n
+
+	return f
+}
+
+// Set the maximum amount of jitter added to each delay. The jitter is
+// not carried forward to the following delays.
+func (f *Fibonacci) SetJitter(dt time.Duration) *Fibonacci {
+	f.jitter = dt
+	f.nextDelay = f.cur + randomDuration(f.rand, f.jitter)
+
+	return f
+}
+
+// Set the clock used to measure elapsed time and to sleep.
+func (f *Fibonacci) SetClock(clock Clock) *Fibonacci {
+	f.clock = clock
+
+	return f
+}
+
+// Set the source of randomness for the jitter.
+func (f *Fibonacci) SetRand(rnd Rand) *Fibonacci {
+	f.rand = rnd
+	f.nextDelay = f.cur + randomDuration(f.rand, f.jitter)
+
+	return f
+}
+
+// Reset a helper to "no tries, next delay will be one unit plus some
+// random jitter".
+func (f *Fibonacci) Reset() *Fibonacci {
+	f.reset()
+	f.first()
+
+	return f
+}
@@ -0,0 +1,103 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStrategyDelays(t *testing.T) {
+	cases := []struct {
+		name   string
+		helper func(*fakeClock) BackoffHelper
+		want   []time.Duration
+	}{
+		{
+			"constant",
+			func(c *fakeClock) BackoffHelper { return NewConstant(time.Second).SetClock(c) },
+			[]time.Duration{time.Second, time.Second, time.Second, time.Second, time.Second},
+		},
+		{
+			"linear",
+			func(c *fakeClock) BackoffHelper {
+				return NewLinear(time.Second, 2*time.Second).SetRetries(4).SetClock(c)
+			},
+			[]time.Duration{time.Second, 3 * time.Second, 5 * time.Second, 7 * time.Second},
+		},
+		{
+			"fibonacci",
+			func(c *fakeClock) BackoffHelper {
+				return NewFibonacci(time.Second).SetRetries(7).SetClock(c)
+			},
+			[]time.Duration{time.Second, time.Second, 2 * time.Second, 3 * time.Second, 5 * time.Second, 8 * time.Second, 13 * time.Second},
+		},
+	}
+
+	for _, tc := range cases {
+		clock := &fakeClock{now: time.Unix(1000, 0)}
+		h := tc.helper(clock)
+		for h.Again() {
+		}
+		if len(clock.sleeps) != len(tc.want) {
+			t.Errorf("%s: want %d sleeps, saw %d", tc.name, len(tc.want), len(clock.sleeps))
+			continue
+		}
+		for ix, w := range tc.want {
+			if clock.sleeps[ix] != w {
+				t.Errorf("%s: sleep #%d, want %v, saw %v", tc.name, ix, w, clock.sleeps[ix])
+			}
+		}
+	}
+}
+
+func TestStrategyJitterAndReset(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	l := NewLinear(time.Second, time.Second).SetJitter(100 * time.Millisecond).SetRetries(3).SetClock(clock)
+
+	for round := 0; round < 2; round++ {
+		clock.sleeps = nil
+		for l.Again() {
+		}
+		if len(clock.sleeps) != 3 {
+			t.Fatalf("Round %d, want 3 sleeps, saw %d", round, len(clock.sleeps))
+		}
+		for ix, d := range clock.sleeps {
+			low := time.Duration(ix+1) * time.Second
+			checkInterval(d, low, low+100*time.Millisecond, t)
+		}
+		l.Reset()
+	}
+
+	clock.sleeps = nil
+	f := NewFibonacci(time.Second).SetJitter(time.Millisecond).SetClock(clock)
+	f.Again()
+	f.Again()
+	f.Again()
+	f.Reset()
+	f.Again()
+	checkInterval(clock.sleeps[3], time.Second, time.Second+time.Millisecond, t)
+}
+
+func TestStrategyWithCall(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	h := NewConstant(time.Second).SetRetries(2).SetClock(clock)
+
+	calls := 0
+	_, err := CallWithHelper(h, func() (int, error) {
+		calls++
+		return 0, errors.New("failing")
+	})
+	if calls != 3 {
+		t.Errorf("Want 3 calls, saw %d", calls)
+	}
+	if !errors.Is(err, RetriesExhausted) {
+		t.Errorf("Want RetriesExhausted, saw %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.Reset().AgainContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Want context.Canceled, saw %v", err)
+	}
+}
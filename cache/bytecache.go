@@ -0,0 +1,224 @@
+package cache
+
+// A cache for string keys and byte slice values, stored in large
+// pre-allocated byte arenas rather than as separate Go values. The
+// index from key hash to arena offset holds no pointers, so the
+// garbage collector never has to scan the cache contents, however
+// many entries it holds.
+//
+// Each shard's arena is a ring buffer: new entries are appended, and
+// the oldest entries are dropped as the buffer wraps around. Entries
+// that are replaced or deleted keep using space until then.
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// The default number of shards in a ByteCache.
+const DefaultByteCacheShards = 64
+
+const (
+	byteHeader    = 8
+	paddingMarker = ^uint32(0)
+	minShardSize  = 1024
+)
+
+type byteShard struct {
+	lock  sync.Mutex
+	index map[uint64]uint64
+	buf   []byte
+	head  uint64
+	tail  uint64
+	stats Stats
+}
+
+// A ByteCache holds string keys and byte slice values, bounded by the
+// total bytes used by keys, values and an 8-byte header per entry.
+type ByteCache struct {
+	shards []byteShard
+}
+
+// Return a new ByteCache, using at most maxBytes bytes of arena split
+// across the given number of shards. A non-positive shards means
+// DefaultByteCacheShards.
+//
+// If the shards would be smaller than 1 KiB each, an error is
+// returned.
+func NewByteCache(maxBytes, shards int) (*ByteCache, error) {
+	if shards < 1 {
+		shards = DefaultByteCacheShards
+	}
+	if maxBytes/shards < minShardSize {
+		return nil, IncorrectlySpecified
+	}
+
+	rv := &ByteCache{shards: make([]byteShard, shards)}
+	for ix := range rv.shards {
+		rv.shards[ix].index = make(map[uint64]uint64)
+		rv.shards[ix].buf = make([]byte, maxBytes/shards)
+	}
+
+	return rv, nil
+}
+
+// FNV-1a, without allocating a hash.Hash.
+func hashString(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+
+	return h
+}
+
+func byteShardFor(c *ByteCache, h uint64) *byteShard {
+	return &c.shards[h%uint64(len(c.shards))]
+}
+
+// Decode the entry header at an absolute offset.
+func byteEntry(s *byteShard, off uint64) (p, keyLen, valueLen uint64) {
+	p = off % uint64(len(s.buf))
+	keyLen = uint64(binary.LittleEndian.Uint32(s.buf[p:]))
+	valueLen = uint64(binary.LittleEndian.Uint32(s.buf[p+4:]))
+
+	return p, keyLen, valueLen
+}
+
+// Drop the oldest entry (or padding) in a shard.
+func byteEvictHead(s *byteShard) {
+	size := uint64(len(s.buf))
+	p := s.head % size
+	if size-p < byteHeader || binary.LittleEndian.Uint32(s.buf[p:]) == paddingMarker {
+		s.head += size - p
+		return
+	}
+
+	_, keyLen, valueLen := byteEntry(s, s.head)
+	h := hashString(string(s.buf[p+byteHeader : p+byteHeader+keyLen]))
+	if off, ok := s.index[h]; ok && off == s.head {
+		delete(s.index, h)
+		s.stats.Evictions++
+	}
+	s.head += byteHeader + keyLen + valueLen
+}
+
+func byteSet(s *byteShard, h uint64, k string, v []byte) bool {
+	size := uint64(len(s.buf))
+	n := uint64(byteHeader + len(k) + len(v))
+	if n > size {
+		return false
+	}
+
+	// Entries never wrap around the end of the buffer, so skip to
+	// the start if the entry does not fit.
+	start := s.tail
+	if p := start % size; size-p < n {
+		start += size - p
+	}
+	for s.head < s.tail && s.head+size < start+n {
+		byteEvictHead(s)
+	}
+	if s.head == s.tail {
+		s.head = start
+	}
+
+	if p := s.tail % size; start != s.tail && size-p >= byteHeader {
+		binary.LittleEndian.PutUint32(s.buf[p:], paddingMarker)
+	}
+	p := start % size
+	binary.LittleEndian.PutUint32(s.buf[p:], uint32(len(k)))
+	binary.LittleEndian.PutUint32(s.buf[p+4:], uint32(len(v)))
+	copy(s.buf[p+byteHeader:], k)
+	copy(s.buf[p+byteHeader+uint64(len(k)):], v)
+
+	s.index[h] = start
+	s.tail = start + n
+
+	return true
+}
+
+// Find the entry for a key, returning the position of its value in
+// the buffer.
+func byteFind(s *byteShard, h uint64, k string) (uint64, uint64, bool) {
+	off, ok := s.index[h]
+	if !ok {
+		return 0, 0, false
+	}
+	p, keyLen, valueLen := byteEntry(s, off)
+	if keyLen != uint64(len(k)) || string(s.buf[p+byteHeader:p+byteHeader+keyLen]) != k {
+		return 0, 0, false
+	}
+
+	return p + byteHeader + keyLen, valueLen, true
+}
+
+// Set the value for a key. The value is copied into the cache. The
+// returned bool is false if the entry is too large to ever fit in a
+// shard, in which case nothing is stored.
+func SetByteCache(c *ByteCache, k string, v []byte) bool {
+	h := hashString(k)
+	s := byteShardFor(c, h)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return byteSet(s, h, k, v)
+}
+
+// Get a copy of the value for a key. The returned bool is true if the
+// key existed, otherwise false.
+func GetByteCache(c *ByteCache, k string) ([]byte, bool) {
+	h := hashString(k)
+	s := byteShardFor(c, h)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p, n, ok := byteFind(s, h, k)
+	if !ok {
+		s.stats.Misses++
+		return nil, false
+	}
+	s.stats.Hits++
+
+	rv := make([]byte, n)
+	copy(rv, s.buf[p:p+n])
+
+	return rv, true
+}
+
+// Delete a key. The returned bool is true if the key existed,
+// otherwise false.
+func DeleteByteCache(c *ByteCache, k string) bool {
+	h := hashString(k)
+	s := byteShardFor(c, h)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, _, ok := byteFind(s, h, k); !ok {
+		return false
+	}
+	delete(s.index, h)
+
+	return true
+}
+
+// Return the usage statistics for a ByteCache, summed over all
+// shards. Bytes is the arena space in use, including space held by
+// replaced and deleted entries not yet overwritten.
+func StatsByteCache(c *ByteCache) Stats {
+	var rv Stats
+
+	for ix := range c.shards {
+		s := &c.shards[ix]
+		s.lock.Lock()
+		rv.Hits += s.stats.Hits
+		rv.Misses += s.stats.Misses
+		rv.Evictions += s.stats.Evictions
+		rv.Size += len(s.index)
+		rv.Bytes += int(s.tail - s.head)
+		s.lock.Unlock()
+	}
+
+	return rv
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestByteCacheSpecification(t *testing.T) {
+	if _, err := NewByteCache(1000, 1); err != IncorrectlySpecified {
+		t.Errorf("Tiny cache did not fail, saw %v", err)
+	}
+	c, err := NewByteCache(64*1024, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(c.shards) != DefaultByteCacheShards {
+		t.Errorf("Want %d shards, saw %d", DefaultByteCacheShards, len(c.shards))
+	}
+}
+
+func TestByteCacheSetGetDelete(t *testing.T) {
+	c, _ := NewByteCache(4096, 2)
+
+	SetByteCache(c, "a", []byte("one"))
+	SetByteCache(c, "b", []byte("two"))
+	SetByteCache(c, "a", []byte("three"))
+
+	cases := []struct {
+		k    string
+		want string
+		ok   bool
+	}{
+		{"a", "three", true},
+		{"b", "two", true},
+		{"c", "", false},
+	}
+	for ix, tc := range cases {
+		got, ok := GetByteCache(c, tc.k)
+		if string(got) != tc.want || ok != tc.ok {
+			t.Errorf("Case #%d, want «%s»/%v, saw «%s»/%v", ix, tc.want, tc.ok, got, ok)
+		}
+	}
+
+	// Values are copied in and out of the arena.
+	v, _ := GetByteCache(c, "b")
+	v[0] = 'X'
+	if again, _ := GetByteCache(c, "b"); string(again) != "two" {
+		t.Errorf("Modifying a returned value changed the cache, saw «%s»", again)
+	}
+
+	if !DeleteByteCache(c, "a") || DeleteByteCache(c, "a") {
+		t.Errorf("Unexpected result deleting a")
+	}
+	if _, ok := GetByteCache(c, "a"); ok {
+		t.Errorf("Deleted key still present")
+	}
+	if SetByteCache(c, "big", make([]byte, 4096)) {
+		t.Errorf("Stored an entry larger than a shard")
+	}
+}
+
+func TestByteCacheWrapAround(t *testing.T) {
+	c, _ := NewByteCache(1024, 1)
+	value := bytes.Repeat([]byte("x"), 89)
+
+	// Each entry is 100 bytes, so the shard holds the last 10, and
+	// wraps around with 24 bytes of padding each turn.
+	for i := 0; i < 1000; i++ {
+		SetByteCache(c, fmt.Sprintf("k%02d", i%100), value)
+
+		for back := 0; back < 10 && back <= i; back++ {
+			k := fmt.Sprintf("k%02d", (i-back)%100)
+			got, ok := GetByteCache(c, k)
+			if !ok || !bytes.Equal(got, value) {
+				t.Fatalf("Step %d, recent key %s missing or corrupt", i, k)
+			}
+		}
+		if i >= 10 {
+			if _, ok := GetByteCache(c, fmt.Sprintf("k%02d", (i-10)%100)); ok {
+				t.Fatalf("Step %d, key written 10 steps ago still present", i)
+			}
+		}
+	}
+
+	stats := StatsByteCache(c)
+	if stats.Size != 10 || stats.Bytes > 1024 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if stats.Evictions != 990 {
+		t.Errorf("Want 990 evictions, saw %d", stats.Evictions)
+	}
+}
+
+const gcBenchEntries = 500000
+
+// Measure the time a full garbage collection takes with a large
+// cache live in the heap.
+func benchmarkGC(b *testing.B, fill func(k string, v []byte), keep func()) {
+	value := make([]byte, 64)
+	for i := 0; i < gcBenchEntries; i++ {
+		fill(fmt.Sprintf("key-%d", i), value)
+	}
+	runtime.GC()
+
+	b.ResetTimer()
+	var total time.Duration
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		runtime.GC()
+		total += time.Since(start)
+	}
+	b.ReportMetric(float64(total.Nanoseconds())/float64(b.N), "gc-ns/op")
+	keep()
+}
+
+func BenchmarkGCWithLRU(b *testing.B) {
+	lru, _ := NewLRUCache("", []byte{}, gcBenchEntries, 0)
+	benchmarkGC(b, func(k string, v []byte) {
+		SetLRU(lru, k, append([]byte{}, v...))
+	}, func() { runtime.KeepAlive(lru) })
+}
+
+func BenchmarkGCWithByteCache(b *testing.B) {
+	c, _ := NewByteCache(gcBenchEntries*100, 0)
+	benchmarkGC(b, func(k string, v []byte) {
+		SetByteCache(c, k, v)
+	}, func() { runtime.KeepAlive(c) })
+}
+
+func BenchmarkByteCacheSet(b *testing.B) {
+	c, _ := NewByteCache(64*1024*1024, 0)
+	value := make([]byte, 64)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		SetByteCache(c, fmt.Sprint(i%100000), value)
+	}
+}
+
+func BenchmarkByteCacheGet(b *testing.B) {
+	c, _ := NewByteCache(64*1024*1024, 0)
+	value := make([]byte, 64)
+	keys := make([]string, 100000)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i)
+		SetByteCache(c, keys[i], value)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		GetByteCache(c, keys[i%len(keys)])
+	}
+}
@@ -4,12 +4,52 @@ package cache
 // functionality (mainly the code to deal with ageing out keys).
 
 import (
+	"context"
 	"errors"
 	"time"
 )
 
 var IncorrectlySpecified = errors.New("Incorrectly specified cache")
 
+// A Loader is called with a key that was not found in a cache, and
+// should return the value for it.
+type Loader[K comparable, V any] func(K) (V, error)
+
+// A ContextLoader is a Loader that takes a context. See
+// GetOrLoadLRUContext for how the context relates to the contexts of
+// the callers waiting for the value.
+type ContextLoader[K comparable, V any] func(context.Context, K) (V, error)
+
+// A BatchLoader is called with all keys that were not found in a
+// cache and should return values for as many of them as it can. Keys
+// missing from the returned map are treated as not existing.
+type BatchLoader[K comparable, V any] func([]K) (map[K]V, error)
+
+// Usage statistics for a cache. Hits, Misses and Evictions are
+// counted from the creation of the cache, Size is the number of
+// entries currently held. Bytes is the approximate memory used by
+// keys and values, and only tracked by memory-bounded caches.
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+	Bytes     int
+}
+
+// A Clock returns the current time. Caches use time.Now unless given
+// another clock, which is mainly useful for simulations and tests.
+type Clock func() time.Time
+
+// Read a clock, falling back to time.Now for a nil clock.
+func clockNow(c Clock) time.Time {
+	if c == nil {
+		return time.Now()
+	}
+
+	return c()
+}
+
 type cacheKey[K comparable] struct {
 	prev, next K
 	timestamp  time.Time
@@ -128,3 +168,57 @@ func sinceOldest[K comparable](ctm *cacheTimeMap[K], now time.Time) time.Duratio
 
 	return now.Sub(ctm.m[ctm.last].timestamp)
 }
+
+// Return the keys not present in a map, in the order they were
+// requested, with any duplicates removed.
+func missingKeys[K comparable, V any](keys []K, found map[K]V) []K {
+	var rv []K
+	seen := make(map[K]bool)
+
+	for _, k := range keys {
+		if _, ok := found[k]; ok || seen[k] {
+			continue
+		}
+		seen[k] = true
+		rv = append(rv, k)
+	}
+
+	return rv
+}
+
+// Remove a specific key, wherever it is in the usage order. Returns
+// true if the key was present.
+func removeKey[K comparable](ctm *cacheTimeMap[K], k K) bool {
+	var zero K
+
+	entry, ok := ctm.m[k]
+	if !ok {
+		return false
+	}
+
+	switch {
+	case len(ctm.m) == 1:
+		ctm.first = zero
+		ctm.last = zero
+	case ctm.first == k:
+		newFirst := ctm.m[entry.next]
+		newFirst.prev = entry.next
+		ctm.m[entry.next] = newFirst
+		ctm.first = entry.next
+	case ctm.last == k:
+		newLast := ctm.m[entry.prev]
+		newLast.next = entry.prev
+		ctm.m[entry.prev] = newLast
+		ctm.last = entry.prev
+	default:
+		oldPrev := ctm.m[entry.prev]
+		oldNext := ctm.m[entry.next]
+		oldPrev.next = entry.next
+		oldNext.prev = entry.prev
+		ctm.m[entry.prev] = oldPrev
+		ctm.m[entry.next] = oldNext
+	}
+	delete(ctm.m, k)
+
+	return true
+}
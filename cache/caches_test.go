@@ -218,3 +218,71 @@ func TestDeletOldestKeyByte(t *testing.T) {
 		checkTimeMap(ix, tc.expected, underTest, t)
 	}
 }
+
+func TestRemoveKeyByte(t *testing.T) {
+	base := func() *cacheTimeMap[byte] {
+		return &cacheTimeMap[byte]{
+			m: map[byte]cacheKey[byte]{
+				30: cacheKey[byte]{prev: 20, next: 30},
+				20: cacheKey[byte]{prev: 10, next: 30},
+				10: cacheKey[byte]{prev: 10, next: 20},
+			},
+			first: 10,
+			last:  30,
+		}
+	}
+
+	cases := []keyTestCase[byte]{
+		{ // 0
+			key: 10,
+			expected: &cacheTimeMap[byte]{
+				m: map[byte]cacheKey[byte]{
+					30: cacheKey[byte]{prev: 20, next: 30},
+					20: cacheKey[byte]{prev: 20, next: 30},
+				},
+				first: 20,
+				last:  30,
+			},
+		},
+		{ // 1
+			key: 20,
+			expected: &cacheTimeMap[byte]{
+				m: map[byte]cacheKey[byte]{
+					30: cacheKey[byte]{prev: 10, next: 30},
+					10: cacheKey[byte]{prev: 10, next: 30},
+				},
+				first: 10,
+				last:  30,
+			},
+		},
+		{ // 2
+			key: 30,
+			expected: &cacheTimeMap[byte]{
+				m: map[byte]cacheKey[byte]{
+					20: cacheKey[byte]{prev: 10, next: 20},
+					10: cacheKey[byte]{prev: 10, next: 20},
+				},
+				first: 10,
+				last:  20,
+			},
+		},
+		{ // 3
+			key:      40,
+			expected: base(),
+		},
+	}
+
+	for ix, tc := range cases {
+		underTest := base()
+		removed := removeKey(underTest, tc.key)
+		if removed != (tc.key != 40) {
+			t.Errorf("Case #%d, unexpected return value %v", ix, removed)
+		}
+		checkTimeMap(ix, tc.expected, underTest, t)
+	}
+
+	underTest := newCacheTimeMap(byte(0))
+	updateTimeMap(underTest, 10, time.Unix(0, 0))
+	removeKey(underTest, 10)
+	checkTimeMap(4, &cacheTimeMap[byte]{m: map[byte]cacheKey[byte]{}}, underTest, t)
+}
@@ -0,0 +1,123 @@
+package cache
+
+// Change notifications for caches. Subscribers receive events on a
+// bounded channel, and are removed when their context is done.
+
+import (
+	"context"
+	"sync"
+)
+
+// The kind of change an event describes.
+type EventKind int
+
+const (
+	// A value was stored for a key not previously in the cache.
+	EventSet EventKind = iota
+	// A value was stored for a key already in the cache.
+	EventReplace
+	// A key was aged out of the cache.
+	EventEvict
+	// A key was explicitly deleted from the cache.
+	EventDelete
+	// A key was removed as part of invalidating a tag.
+	EventInvalidate
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventSet:
+		return "set"
+	case EventReplace:
+		return "replace"
+	case EventEvict:
+		return "evict"
+	case EventDelete:
+		return "delete"
+	case EventInvalidate:
+		return "invalidate"
+	}
+
+	return "unknown"
+}
+
+// A change to a cache. Old is the zero value for EventSet, New is the
+// zero value for all kinds of removal.
+type Event[K comparable, V any] struct {
+	Kind EventKind
+	Key  K
+	Old  V
+	New  V
+}
+
+// What to do with an event when a subscriber's channel is full.
+type OverflowPolicy int
+
+const (
+	// Drop the event, and carry on.
+	DropOnFull OverflowPolicy = iota
+	// Wait until there is room in the channel. Note that this
+	// stalls all use of the cache until the subscriber catches up,
+	// or its context is done.
+	BlockOnFull
+)
+
+// Called whenever an entry leaves a cache, with the reason it left
+// (EventEvict, EventDelete or EventInvalidate). Callbacks are called
+// with the cache locked, so must not use the cache themselves.
+type EvictionCallback[K comparable, V any] func(k K, v V, reason EventKind)
+
+type subscriber[K comparable, V any] struct {
+	c      chan Event[K, V]
+	done   <-chan struct{}
+	policy OverflowPolicy
+}
+
+// Add a subscriber to a list guarded by lock. Once ctx is done, the
+// subscriber is removed and its channel closed.
+func subscribe[K comparable, V any](lock *sync.Mutex, subs *[]*subscriber[K, V], ctx context.Context, size int, policy OverflowPolicy) <-chan Event[K, V] {
+	s := &subscriber[K, V]{
+		c:      make(chan Event[K, V], size),
+		done:   ctx.Done(),
+		policy: policy,
+	}
+
+	lock.Lock()
+	*subs = append(*subs, s)
+	lock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		lock.Lock()
+		defer lock.Unlock()
+
+		for ix, other := range *subs {
+			if other == s {
+				*subs = append((*subs)[:ix:ix], (*subs)[ix+1:]...)
+				break
+			}
+		}
+		close(s.c)
+	}()
+
+	return s.c
+}
+
+// Send an event to all subscribers. Must be called with the lock
+// guarding the subscriber list held.
+func emit[K comparable, V any](subs []*subscriber[K, V], ev Event[K, V]) {
+	for _, s := range subs {
+		switch s.policy {
+		case BlockOnFull:
+			select {
+			case s.c <- ev:
+			case <-s.done:
+			}
+		default:
+			select {
+			case s.c <- ev:
+			default:
+			}
+		}
+	}
+}
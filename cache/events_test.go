@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func receive[K comparable, V any](t *testing.T, c <-chan Event[K, V]) Event[K, V] {
+	select {
+	case ev := <-c:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for event")
+	}
+
+	var zero Event[K, V]
+	return zero
+}
+
+func TestSubscribeLRW(t *testing.T) {
+	lrw, _ := NewLRWCache("", 0, 2, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := SubscribeLRW(ctx, lrw, 10, DropOnFull)
+
+	SetLRW(lrw, "a", 1)
+	SetLRW(lrw, "a", 2)
+	SetLRW(lrw, "b", 3)
+	SetLRW(lrw, "c", 4)
+	DeleteLRW(lrw, "b")
+	DeleteLRW(lrw, "nope")
+
+	want := []Event[string, int]{
+		{Kind: EventSet, Key: "a", New: 1},
+		{Kind: EventReplace, Key: "a", Old: 1, New: 2},
+		{Kind: EventSet, Key: "b", New: 3},
+		{Kind: EventSet, Key: "c", New: 4},
+		{Kind: EventEvict, Key: "a", Old: 2},
+		{Kind: EventDelete, Key: "b", Old: 3},
+	}
+	for ix, w := range want {
+		if got := receive(t, c); got != w {
+			t.Errorf("Event #%d, want %+v, saw %+v", ix, w, got)
+		}
+	}
+
+	cancel()
+	for range c {
+	}
+	SetLRW(lrw, "d", 5)
+	if len(lrw.subs) != 0 {
+		t.Errorf("Subscriber still registered after cancel")
+	}
+}
+
+func TestSubscribeDrop(t *testing.T) {
+	lru, _ := NewLRUCache(0, 0, 10, 0)
+	c := SubscribeLRU(context.Background(), lru, 1, DropOnFull)
+
+	SetLRU(lru, 1, 1)
+	SetLRU(lru, 2, 2)
+
+	if ev := receive(t, c); ev.Key != 1 {
+		t.Errorf("Unexpected first event %+v", ev)
+	}
+	select {
+	case ev := <-c:
+		t.Errorf("Event %+v should have been dropped", ev)
+	default:
+	}
+}
+
+func TestSubscribeBlock(t *testing.T) {
+	lru, _ := NewLRUCache(0, 0, 10, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := SubscribeLRU(ctx, lru, 1, BlockOnFull)
+
+	done := make(chan struct{})
+	go func() {
+		SetLRU(lru, 1, 1)
+		SetLRU(lru, 2, 2)
+		close(done)
+	}()
+
+	for _, k := range []int{1, 2} {
+		if ev := receive(t, c); ev.Key != k {
+			t.Errorf("Want event for key %d, saw %+v", k, ev)
+		}
+	}
+	<-done
+
+	// A blocked send must give up once the subscriber goes away.
+	SetLRU(lru, 3, 3)
+	blocked := make(chan struct{})
+	go func() {
+		SetLRU(lru, 4, 4)
+		close(blocked)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-blocked:
+	case <-time.After(time.Second):
+		t.Errorf("Set still blocked after subscriber cancelled")
+	}
+}
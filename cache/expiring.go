@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// Implements a cache where entries expire a set time after they were
+// last accessed, and a (separate) set time after they were last
+// written, whichever comes first. Optionally, the number of entries
+// is bounded too, evicting the least recently used entries.
+//
+// As with the LRU and LRW caches, expired entries are also aged out
+// when reading, so a read never returns an expired entry.
+type Expiring[K comparable, V any] struct {
+	lock        sync.Mutex
+	m           map[K]V
+	accessed    *cacheTimeMap[K]
+	written     *cacheTimeMap[K]
+	maxSize     int
+	afterAccess time.Duration
+	afterWrite  time.Duration
+	stats       Stats
+	clock       Clock
+}
+
+// Return a new cache with independent expiry after access and after
+// write.
+//
+// The provided key (k) and value (v) are ONLY used for their type(s).
+//
+// If a non-positive maxSize is provided, the size of the cache is
+// unbounded. A zero afterAccess or afterWrite disables that kind of
+// expiry. If the cache would be entirely unbounded, an error is
+// returned.
+func NewExpiringCache[K comparable, V any](k K, v V, maxSize int, afterAccess, afterWrite time.Duration) (*Expiring[K, V], error) {
+	if (maxSize < 1) && (afterAccess == 0) && (afterWrite == 0) {
+		return nil, IncorrectlySpecified
+	}
+	rv := new(Expiring[K, V])
+	rv.m = make(map[K]V)
+	rv.accessed = newCacheTimeMap(k)
+	rv.written = newCacheTimeMap(k)
+	rv.maxSize = maxSize
+	rv.afterAccess = afterAccess
+	rv.afterWrite = afterWrite
+
+	return rv, nil
+}
+
+// Remove a key from both usage orders and the value map.
+func expiringRemove[K comparable, V any](c *Expiring[K, V], k K) {
+	delete(c.m, k)
+	removeKey(c.accessed, k)
+	removeKey(c.written, k)
+}
+
+// Age out entries from one of the usage orders, until the oldest
+// entry in it is younger than maxAge.
+func expiringAgeOrder[K comparable, V any](c *Expiring[K, V], ctm *cacheTimeMap[K], maxAge time.Duration, now time.Time) {
+	if maxAge <= 0 {
+		return
+	}
+	for len(ctm.m) > 0 && sinceOldest(ctm, now) >= maxAge {
+		expiringRemove(c, ctm.last)
+		c.stats.Evictions++
+	}
+}
+
+// Age out expired entries, then evict least recently used entries
+// until we are under the max size of the cache.
+func expiringAge[K comparable, V any](c *Expiring[K, V], now time.Time) {
+	expiringAgeOrder(c, c.accessed, c.afterAccess, now)
+	expiringAgeOrder(c, c.written, c.afterWrite, now)
+
+	if c.maxSize > 0 {
+		for len(c.m) > c.maxSize {
+			expiringRemove(c, c.accessed.last)
+			c.stats.Evictions++
+		}
+	}
+}
+
+func expiringSet[K comparable, V any](c *Expiring[K, V], k K, v V, now time.Time) {
+	c.m[k] = v
+	updateTimeMap(c.accessed, k, now)
+	updateTimeMap(c.written, k, now)
+	expiringAge(c, now)
+}
+
+func expiringGet[K comparable, V any](c *Expiring[K, V], k K, now time.Time) (V, bool) {
+	expiringAge(c, now)
+
+	rv, ok := c.m[k]
+	if ok {
+		updateTimeMap(c.accessed, k, now)
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+
+	return rv, ok
+}
+
+// Set cached value for a specific key, counting as both an access and
+// a write. Safe for concurrent use.
+func SetExpiring[K comparable, V any](c *Expiring[K, V], k K, v V) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	expiringSet(c, k, v, clockNow(c.clock))
+}
+
+// Get cached value for a specific key, counting as an access. The
+// returned bool is true if the key existed, otherwise false.
+func GetExpiring[K comparable, V any](c *Expiring[K, V], k K) (V, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return expiringGet(c, k, clockNow(c.clock))
+}
+
+// Delete a key from the cache. The returned bool is true if the key
+// existed, otherwise false.
+func DeleteExpiring[K comparable, V any](c *Expiring[K, V], k K) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.m[k]; !ok {
+		return false
+	}
+	expiringRemove(c, k)
+
+	return true
+}
+
+// Return the usage statistics for the cache.
+func StatsExpiring[K comparable, V any](c *Expiring[K, V]) Stats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	rv := c.stats
+	rv.Size = len(c.m)
+
+	return rv
+}
+
+// Set the clock used by an Expiring cache. A nil clock means time.Now.
+func SetClockExpiring[K comparable, V any](c *Expiring[K, V], clock Clock) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.clock = clock
+}
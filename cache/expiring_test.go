@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiringSpecification(t *testing.T) {
+	if _, err := NewExpiringCache(0, 0, 0, 0, 0); err != IncorrectlySpecified {
+		t.Errorf("Unbounded cache did not fail, saw %v", err)
+	}
+	if _, err := NewExpiringCache(0, 0, 0, 0, time.Second); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestExpiringAccessAndWrite(t *testing.T) {
+	// Expire 10s after last access, or 60s after last write.
+	c, _ := NewExpiringCache("", 0, 0, 10*time.Second, 60*time.Second)
+
+	cases := []struct {
+		at  int64
+		set bool
+		k   string
+		v   int
+		ok  bool
+	}{
+		{0, true, "a", 1, false},
+		{0, true, "b", 2, false},
+		{5, false, "a", 1, true},
+		{12, false, "a", 1, true},
+		{12, false, "b", 0, false},
+		{21, false, "a", 1, true},
+		{30, false, "a", 1, true},
+		{39, false, "a", 1, true},
+		{48, false, "a", 1, true},
+		{57, false, "a", 1, true},
+		{60, false, "a", 0, false},
+		{60, true, "a", 2, false},
+		{69, false, "a", 2, true},
+		{80, false, "a", 0, false},
+	}
+
+	for ix, tc := range cases {
+		now := time.Unix(tc.at, 0)
+		if tc.set {
+			expiringSet(c, tc.k, tc.v, now)
+			continue
+		}
+		v, ok := expiringGet(c, tc.k, now)
+		if v != tc.v || ok != tc.ok {
+			t.Errorf("Case #%d, want %d/%v, saw %d/%v", ix, tc.v, tc.ok, v, ok)
+		}
+	}
+
+	if len(c.m) != 0 || len(c.accessed.m) != 0 || len(c.written.m) != 0 {
+		t.Errorf("Cache not empty, %d values, %d accessed, %d written", len(c.m), len(c.accessed.m), len(c.written.m))
+	}
+}
+
+func TestExpiringSize(t *testing.T) {
+	c, _ := NewExpiringCache(0, "", 2, 0, time.Minute)
+
+	SetExpiring(c, 1, "one")
+	SetExpiring(c, 2, "two")
+	GetExpiring(c, 1)
+	SetExpiring(c, 3, "three")
+
+	if _, ok := GetExpiring(c, 2); ok {
+		t.Errorf("Least recently used entry not evicted")
+	}
+	if v, ok := GetExpiring(c, 1); !ok || v != "one" {
+		t.Errorf("Recently used entry evicted")
+	}
+	if !DeleteExpiring(c, 3) || DeleteExpiring(c, 3) {
+		t.Errorf("Unexpected result deleting key")
+	}
+
+	want := Stats{Hits: 2, Misses: 1, Evictions: 1, Size: 1}
+	if got := StatsExpiring(c); got != want {
+		t.Errorf("Want stats %+v, saw %+v", want, got)
+	}
+}
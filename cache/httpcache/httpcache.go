@@ -0,0 +1,483 @@
+package httpcache
+
+// HTTP response caching, backed by an LRU cache. Responses are keyed
+// by method, URL and the values of any request headers named in the
+// response's Vary header. Freshness is controlled by the max-age and
+// no-store Cache-Control directives, and stale responses carrying an
+// ETag are revalidated rather than fetched again.
+//
+// The cache can be used on the client side, wrapping an
+// http.RoundTripper, or on the server side, as middleware in front
+// of an http.Handler. As middleware, it is a shared cache, and does
+// not store private responses, or responses to requests carrying
+// credentials unless the response says it may be shared.
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vatine/goutils/cache"
+)
+
+type entry struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+	etag    string
+}
+
+// A Cache holds HTTP responses. It is safe for concurrent use.
+type Cache struct {
+	responses *cache.LRU[string, *entry]
+	vary      *cache.LRU[string, []string]
+	now       func() time.Time
+}
+
+// Create a new response cache, holding at most maxEntries responses.
+func New(maxEntries int) (*Cache, error) {
+	responses, err := cache.NewLRUCache("", &entry{}, maxEntries, 0)
+	if err != nil {
+		return nil, err
+	}
+	vary, err := cache.NewLRUCache("", []string{}, maxEntries, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cache{responses: responses, vary: vary, now: time.Now}, nil
+}
+
+// Parse a Cache-Control header into a map from (lower-cased)
+// directive to its value, if any.
+func cacheControl(h http.Header) map[string]string {
+	rv := make(map[string]string)
+
+	for _, line := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, value := part, ""
+			if ix := strings.Index(part, "="); ix >= 0 {
+				name, value = part[:ix], strings.Trim(part[ix+1:], `"`)
+			}
+			rv[strings.ToLower(strings.TrimSpace(name))] = value
+		}
+	}
+
+	return rv
+}
+
+func cacheableMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// The key for a request, ignoring the headers it varies by. Server
+// side requests only carry the path in their URL, so the scheme and
+// host are filled in, to keep virtual hosts apart.
+func baseKey(r *http.Request) string {
+	u := *r.URL
+	if u.Host == "" {
+		u.Host = r.Host
+		u.Scheme = "http"
+		if r.TLS != nil {
+			u.Scheme = "https"
+		}
+	}
+
+	return r.Method + " " + u.String()
+}
+
+// Return the names of the headers a response varies by, in canonical
+// form and sorted. The second return value is false if the response
+// varies by "*", which makes it uncacheable.
+func varyNames(h http.Header) ([]string, bool) {
+	var rv []string
+
+	for _, line := range h.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" {
+				rv = append(rv, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(rv)
+
+	return rv, true
+}
+
+func variantKey(base string, names []string, h http.Header) string {
+	var sb strings.Builder
+
+	sb.WriteString(base)
+	for _, name := range names {
+		sb.WriteString("\n")
+		sb.WriteString(name)
+		sb.WriteString(": ")
+		sb.WriteString(strings.Join(h.Values(name), ", "))
+	}
+
+	return sb.String()
+}
+
+// Find the cached entry for a request, if any. The returned bool is
+// true if the entry is still fresh.
+func (c *Cache) lookup(r *http.Request) (*entry, bool) {
+	base := baseKey(r)
+	names, ok := cache.GetLRU(c.vary, base)
+	if !ok {
+		return nil, false
+	}
+	e, ok := cache.GetLRU(c.responses, variantKey(base, names, r.Header))
+	if !ok {
+		return nil, false
+	}
+
+	return e, c.now().Before(e.expires)
+}
+
+// Compute when a response stops being fresh. The returned bool is
+// false if the response must not be stored. A shared cache prefers
+// s-maxage over max-age.
+func (c *Cache) expiry(status int, h http.Header, shared bool) (time.Time, bool) {
+	if status != http.StatusOK {
+		return time.Time{}, false
+	}
+	cc := cacheControl(h)
+	if _, ok := cc["no-store"]; ok {
+		return time.Time{}, false
+	}
+
+	now := c.now()
+	if _, ok := cc["no-cache"]; ok {
+		return now, h.Get("ETag") != ""
+	}
+	if v, ok := cc["s-maxage"]; ok && shared {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return now.Add(time.Duration(secs) * time.Second), true
+		}
+	}
+	if v, ok := cc["max-age"]; ok {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return now.Add(time.Duration(secs) * time.Second), true
+		}
+	}
+
+	// Without an explicit lifetime, a response is only worth
+	// keeping if it can be revalidated.
+	return now, h.Get("ETag") != ""
+}
+
+// Check if a shared cache may store a response, as per RFC 9111,
+// sections 3 and 3.5: not if it is private, and for requests with
+// credentials, only if the response explicitly allows it.
+func sharedStorable(r *http.Request, h http.Header) bool {
+	cc := cacheControl(h)
+	if _, ok := cc["private"]; ok {
+		return false
+	}
+	if r.Header.Get("Authorization") == "" {
+		return true
+	}
+	for _, allowed := range []string{"public", "must-revalidate", "s-maxage"} {
+		if _, ok := cc[allowed]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Decide whether a response to a request may be stored, before
+// reading its body. Returns the headers the response varies by and
+// when it stops being fresh.
+func (c *Cache) storable(r *http.Request, status int, h http.Header, shared bool) ([]string, time.Time, bool) {
+	if !cacheableMethod(r.Method) {
+		return nil, time.Time{}, false
+	}
+	if _, ok := cacheControl(r.Header)["no-store"]; ok {
+		return nil, time.Time{}, false
+	}
+	if shared && !sharedStorable(r, h) {
+		return nil, time.Time{}, false
+	}
+	names, ok := varyNames(h)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	expires, ok := c.expiry(status, h, shared)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+
+	return names, expires, true
+}
+
+// Store a response for a request, if the response allows it. Returns
+// the stored entry, or nil if nothing was stored.
+func (c *Cache) store(r *http.Request, status int, h http.Header, body []byte, shared bool) *entry {
+	names, expires, ok := c.storable(r, status, h, shared)
+	if !ok {
+		return nil
+	}
+
+	e := &entry{
+		status:  status,
+		header:  h.Clone(),
+		body:    body,
+		expires: expires,
+		etag:    h.Get("ETag"),
+	}
+	base := baseKey(r)
+	cache.SetLRU(c.vary, base, names)
+	cache.SetLRU(c.responses, variantKey(base, names, r.Header), e)
+
+	return e
+}
+
+// Mark a cached entry as fresh again, after a successful
+// revalidation. The new headers from the 304 response replace the
+// stored ones.
+func (c *Cache) refresh(r *http.Request, old *entry, h http.Header, shared bool) *entry {
+	merged := old.header.Clone()
+	for name, values := range h {
+		merged[name] = values
+	}
+
+	if e := c.store(r, old.status, merged, old.body, shared); e != nil {
+		return e
+	}
+
+	return old
+}
+
+// Check whether a request's If-None-Match header matches an ETag.
+func etagMatches(r *http.Request, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, line := range r.Header.Values("If-None-Match") {
+		for _, tag := range strings.Split(line, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Can a cached response be used for the request, provided it is
+// fresh?
+func usable(r *http.Request) bool {
+	if !cacheableMethod(r.Method) {
+		return false
+	}
+	cc := cacheControl(r.Header)
+	_, noCache := cc["no-cache"]
+	_, noStore := cc["no-store"]
+
+	return !noCache && !noStore
+}
+
+// A Transport is an http.RoundTripper that serves responses from a
+// Cache where possible, and passes requests on to the next
+// RoundTripper otherwise.
+type Transport struct {
+	cache *Cache
+	next  http.RoundTripper
+}
+
+// Create a caching transport. If next is nil, http.DefaultTransport
+// is used.
+func NewTransport(c *Cache, next http.RoundTripper) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &Transport{cache: c, next: next}
+}
+
+func (e *entry) response(r *http.Request) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(e.status) + " " + http.StatusText(e.status),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       r,
+	}
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !cacheableMethod(r.Method) {
+		return t.next.RoundTrip(r)
+	}
+
+	cached, fresh := t.cache.lookup(r)
+	if cached != nil && fresh && usable(r) {
+		return cached.response(r), nil
+	}
+
+	out := r
+	if cached != nil && cached.etag != "" && r.Header.Get("If-None-Match") == "" {
+		out = r.Clone(r.Context())
+		out.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := t.next.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	if out != r && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return t.cache.refresh(r, cached, resp.Header, false).response(r), nil
+	}
+
+	// Only read the body of responses that will be stored, so
+	// that anything else is streamed to the caller as usual.
+	if _, _, ok := t.cache.storable(r, resp.StatusCode, resp.Header, false); !ok {
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	t.cache.store(r, resp.StatusCode, resp.Header, body, false)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	return resp, nil
+}
+
+// Sits between a handler and the client. Once the handler has
+// written its headers, keep decides whether the response is buffered,
+// to be cached, or passed straight through to the client.
+type recorder struct {
+	w      http.ResponseWriter
+	keep   func(status int, h http.Header) bool
+	header http.Header
+	status int
+	buffer bool
+	body   bytes.Buffer
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status != 0 {
+		return
+	}
+	rec.status = status
+	rec.buffer = rec.keep(status, rec.header)
+	if !rec.buffer {
+		for name, values := range rec.header {
+			rec.w.Header()[name] = values
+		}
+		rec.w.WriteHeader(status)
+	}
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	if rec.buffer {
+		return rec.body.Write(b)
+	}
+	return rec.w.Write(b)
+}
+
+// Flush passed-through responses, so streaming handlers keep
+// working. Buffered responses are written once the handler is done.
+func (rec *recorder) Flush() {
+	rec.WriteHeader(http.StatusOK)
+	if f, ok := rec.w.(http.Flusher); ok && !rec.buffer {
+		f.Flush()
+	}
+}
+
+// Write a cached entry to a client, answering with 304 Not Modified
+// if the client already has it.
+func (e *entry) serve(w http.ResponseWriter, r *http.Request) {
+	for name, values := range e.header {
+		w.Header()[name] = values
+	}
+	if etagMatches(r, e.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(e.status)
+	if r.Method != http.MethodHead {
+		w.Write(e.body)
+	}
+}
+
+// Wrap an http.Handler in a response cache. Requests that can be
+// answered from the cache never reach the wrapped handler; stale
+// entries with an ETag are revalidated by passing a conditional
+// request to the wrapped handler.
+func Handler(c *Cache, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cacheableMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cached, fresh := c.lookup(r)
+		if cached != nil && fresh && usable(r) {
+			cached.serve(w, r)
+			return
+		}
+
+		in := r
+		if cached != nil && cached.etag != "" {
+			in = r.Clone(r.Context())
+			in.Header.Set("If-None-Match", cached.etag)
+		}
+
+		rec := &recorder{w: w, header: make(http.Header)}
+		rec.keep = func(status int, h http.Header) bool {
+			if in != r && status == http.StatusNotModified {
+				return true
+			}
+			_, _, ok := c.storable(r, status, h, true)
+			return ok
+		}
+		next.ServeHTTP(rec, in)
+		rec.WriteHeader(http.StatusOK)
+		if !rec.buffer {
+			return
+		}
+
+		if in != r && rec.status == http.StatusNotModified {
+			c.refresh(r, cached, rec.header, true).serve(w, r)
+			return
+		}
+		if e := c.store(r, rec.status, rec.header, rec.body.Bytes(), true); e != nil {
+			e.serve(w, r)
+			return
+		}
+
+		for name, values := range rec.header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	})
+}
@@ -0,0 +1,346 @@
+package httpcache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+// An origin handler that counts how often it is called, and how often
+// it answered a conditional request with 304.
+type origin struct {
+	calls        int
+	notModified  int
+	cacheControl string
+	etag         string
+	vary         string
+}
+
+func (o *origin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.calls++
+	if o.cacheControl != "" {
+		w.Header().Set("Cache-Control", o.cacheControl)
+	}
+	if o.vary != "" {
+		w.Header().Set("Vary", o.vary)
+	}
+	if o.etag != "" {
+		w.Header().Set("ETag", o.etag)
+		if r.Header.Get("If-None-Match") == o.etag {
+			o.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	io.WriteString(w, "hello "+r.Header.Get("Accept-Language"))
+}
+
+func newTestCache(t *testing.T) (*Cache, *fakeClock) {
+	c, err := New(10)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	c.now = clock.Now
+
+	return c, clock
+}
+
+func get(t *testing.T, client *http.Client, url string, headers map[string]string) (int, string) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	return resp.StatusCode, string(body)
+}
+
+func TestTransportMaxAge(t *testing.T) {
+	o := &origin{cacheControl: "max-age=60"}
+	server := httptest.NewServer(o)
+	defer server.Close()
+
+	c, clock := newTestCache(t)
+	client := &http.Client{Transport: NewTransport(c, nil)}
+
+	for i := 0; i < 3; i++ {
+		status, body := get(t, client, server.URL, nil)
+		if status != http.StatusOK || body != "hello " {
+			t.Errorf("Request #%d, unexpected response %d «%s»", i, status, body)
+		}
+	}
+	if o.calls != 1 {
+		t.Errorf("Want 1 call to origin, saw %d", o.calls)
+	}
+
+	clock.now = clock.now.Add(61 * time.Second)
+	get(t, client, server.URL, nil)
+	if o.calls != 2 {
+		t.Errorf("Want 2 calls to origin after expiry, saw %d", o.calls)
+	}
+
+	get(t, client, server.URL, map[string]string{"Cache-Control": "no-cache"})
+	if o.calls != 3 {
+		t.Errorf("Want 3 calls to origin after no-cache request, saw %d", o.calls)
+	}
+}
+
+func TestTransportNoStore(t *testing.T) {
+	o := &origin{cacheControl: "no-store, max-age=60"}
+	server := httptest.NewServer(o)
+	defer server.Close()
+
+	c, _ := newTestCache(t)
+	client := &http.Client{Transport: NewTransport(c, nil)}
+
+	get(t, client, server.URL, nil)
+	get(t, client, server.URL, nil)
+	if o.calls != 2 {
+		t.Errorf("Want 2 calls to origin, saw %d", o.calls)
+	}
+}
+
+func TestTransportRevalidate(t *testing.T) {
+	o := &origin{cacheControl: "max-age=10", etag: `"v1"`}
+	server := httptest.NewServer(o)
+	defer server.Close()
+
+	c, clock := newTestCache(t)
+	client := &http.Client{Transport: NewTransport(c, nil)}
+
+	get(t, client, server.URL, nil)
+	clock.now = clock.now.Add(20 * time.Second)
+	status, body := get(t, client, server.URL, nil)
+
+	if status != http.StatusOK || body != "hello " {
+		t.Errorf("Unexpected response after revalidation %d «%s»", status, body)
+	}
+	if o.calls != 2 || o.notModified != 1 {
+		t.Errorf("Want 2 calls and 1 revalidation, saw %d and %d", o.calls, o.notModified)
+	}
+
+	get(t, client, server.URL, nil)
+	if o.calls != 2 {
+		t.Errorf("Revalidated response was not fresh again, saw %d calls", o.calls)
+	}
+}
+
+func TestTransportVary(t *testing.T) {
+	o := &origin{cacheControl: "max-age=60", vary: "Accept-Language"}
+	server := httptest.NewServer(o)
+	defer server.Close()
+
+	c, _ := newTestCache(t)
+	client := &http.Client{Transport: NewTransport(c, nil)}
+
+	_, en := get(t, client, server.URL, map[string]string{"Accept-Language": "en"})
+	_, sv := get(t, client, server.URL, map[string]string{"Accept-Language": "sv"})
+	_, en2 := get(t, client, server.URL, map[string]string{"Accept-Language": "en"})
+
+	if en != "hello en" || sv != "hello sv" || en2 != "hello en" {
+		t.Errorf("Unexpected bodies «%s» «%s» «%s»", en, sv, en2)
+	}
+	if o.calls != 2 {
+		t.Errorf("Want 2 calls to origin, saw %d", o.calls)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	o := &origin{cacheControl: "max-age=10", etag: `"v1"`}
+	c, clock := newTestCache(t)
+	server := httptest.NewServer(Handler(c, o))
+	defer server.Close()
+	client := server.Client()
+
+	get(t, client, server.URL, nil)
+	status, body := get(t, client, server.URL, nil)
+	if status != http.StatusOK || body != "hello " {
+		t.Errorf("Unexpected cached response %d «%s»", status, body)
+	}
+	if o.calls != 1 {
+		t.Errorf("Want 1 call to handler, saw %d", o.calls)
+	}
+
+	status, _ = get(t, client, server.URL, map[string]string{"If-None-Match": `"v1"`})
+	if status != http.StatusNotModified {
+		t.Errorf("Want 304 for matching ETag, saw %d", status)
+	}
+
+	clock.now = clock.now.Add(20 * time.Second)
+	status, body = get(t, client, server.URL, nil)
+	if status != http.StatusOK || body != "hello " {
+		t.Errorf("Unexpected revalidated response %d «%s»", status, body)
+	}
+	if o.calls != 2 || o.notModified != 1 {
+		t.Errorf("Want 2 calls and 1 revalidation, saw %d and %d", o.calls, o.notModified)
+	}
+}
+
+func TestHandlerVirtualHosts(t *testing.T) {
+	c, _ := newTestCache(t)
+	calls := 0
+	h := Handler(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, "hello "+r.Host)
+	}))
+
+	cases := []struct {
+		host  string
+		calls int
+	}{
+		{"a.example", 1},
+		{"b.example", 2},
+		{"a.example", 2},
+		{"b.example", 2},
+	}
+
+	for ix, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/page", nil)
+		req.Host = tc.host
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if body := w.Body.String(); body != "hello "+tc.host {
+			t.Errorf("Case #%d, want «hello %s», saw «%s»", ix, tc.host, body)
+		}
+		if calls != tc.calls {
+			t.Errorf("Case #%d, want %d calls to handler, saw %d", ix, tc.calls, calls)
+		}
+	}
+}
+
+func TestHandlerUncacheable(t *testing.T) {
+	o := &origin{}
+	c, _ := newTestCache(t)
+	server := httptest.NewServer(Handler(c, o))
+	defer server.Close()
+
+	get(t, server.Client(), server.URL, nil)
+	status, body := get(t, server.Client(), server.URL, nil)
+	if status != http.StatusOK || body != "hello " {
+		t.Errorf("Unexpected response %d «%s»", status, body)
+	}
+	if o.calls != 2 {
+		t.Errorf("Want 2 calls to handler, saw %d", o.calls)
+	}
+}
+
+func TestHandlerShared(t *testing.T) {
+	cases := []struct {
+		cacheControl string
+		headers      map[string]string
+		calls        int
+	}{
+		{"max-age=60, private", nil, 2},
+		{"max-age=60", map[string]string{"Authorization": "Bearer alice"}, 2},
+		{"max-age=60, public", map[string]string{"Authorization": "Bearer alice"}, 1},
+		{"s-maxage=60", map[string]string{"Authorization": "Bearer alice"}, 1},
+	}
+
+	for ix, tc := range cases {
+		o := &origin{cacheControl: tc.cacheControl}
+		c, _ := newTestCache(t)
+		server := httptest.NewServer(Handler(c, o))
+
+		get(t, server.Client(), server.URL, tc.headers)
+		get(t, server.Client(), server.URL, nil)
+		if o.calls != tc.calls {
+			t.Errorf("Case #%d, want %d calls to handler, saw %d", ix, tc.calls, o.calls)
+		}
+		server.Close()
+	}
+}
+
+func TestTransportPrivate(t *testing.T) {
+	// On the client side, the cache is private, so private
+	// responses are stored.
+	o := &origin{cacheControl: "max-age=60, private"}
+	server := httptest.NewServer(o)
+	defer server.Close()
+
+	c, _ := newTestCache(t)
+	client := &http.Client{Transport: NewTransport(c, nil)}
+	get(t, client, server.URL, nil)
+	get(t, client, server.URL, nil)
+	if o.calls != 1 {
+		t.Errorf("Want 1 call to origin, saw %d", o.calls)
+	}
+}
+
+func TestHandlerStreaming(t *testing.T) {
+	c, _ := newTestCache(t)
+	proceed := make(chan struct{})
+	streamer := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first\n")
+		w.(http.Flusher).Flush()
+		<-proceed
+		io.WriteString(w, "second\n")
+	})
+	server := httptest.NewServer(Handler(c, streamer))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The first line arrives before the handler is done.
+	line := make([]byte, 6)
+	if _, err := io.ReadFull(resp.Body, line); err != nil || string(line) != "first\n" {
+		t.Errorf("Want the first line, saw «%s», %v", line, err)
+	}
+	close(proceed)
+	rest, _ := io.ReadAll(resp.Body)
+	if string(rest) != "second\n" {
+		t.Errorf("Want the second line, saw «%s»", rest)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestTransportStreaming(t *testing.T) {
+	c, _ := newTestCache(t)
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	next := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: pr, Request: r}, nil
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/stream", nil)
+	done := make(chan *http.Response)
+	go func() {
+		resp, _ := NewTransport(c, next).RoundTrip(req)
+		done <- resp
+	}()
+
+	select {
+	case resp := <-done:
+		if resp == nil || resp.Body != io.ReadCloser(pr) {
+			t.Errorf("Uncacheable response was not passed through as-is")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("RoundTrip waited for the whole body of an uncacheable response")
+	}
+}
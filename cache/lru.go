@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -17,6 +18,17 @@ type LRU[K comparable, V any] struct {
 	keys    *cacheTimeMap[K]
 	maxSize int
 	maxAge  time.Duration
+	stats   Stats
+	flights flightGroup[K, V]
+	subs    []*subscriber[K, V]
+	onEvict EvictionCallback[K, V]
+	tags    tagIndex[K]
+	index   keyIndex[K]
+	clock   Clock
+
+	maxBytes int
+	bytes    int
+	sizes    map[K]int
 }
 
 // Return a new Least Recently Used (LRU) cache.
@@ -39,8 +51,32 @@ func NewLRUCache[K comparable, V any](k K, v V, maxSize int, maxAge time.Duratio
 	return rv, nil
 }
 
-// Age out oldest entries, until there are (a) bo too-old entries left
-// and (b) we are under the max size of the cache.
+// Return a new LRU cache bounded by the approximate number of bytes
+// used by its keys and values, as computed by EstimateSize. Values
+// that are expensive to estimate by reflection can implement Sizer.
+//
+// The provided key (k) and value (v) are ONLY used for their type(s).
+//
+// If a "zero" time is provided, the "age" is unbounded. If maxBytes
+// is not positive, an error is returned. An entry larger than
+// maxBytes on its own is evicted straight away.
+func NewMemoryBoundedLRU[K comparable, V any](k K, v V, maxBytes int, maxAge time.Duration) (*LRU[K, V], error) {
+	if maxBytes < 1 {
+		return nil, IncorrectlySpecified
+	}
+	rv := new(LRU[K, V])
+	rv.m = make(map[K]V)
+	rv.keys = newCacheTimeMap(k)
+	rv.maxAge = maxAge
+	rv.maxBytes = maxBytes
+	rv.sizes = make(map[K]int)
+
+	return rv, nil
+}
+
+// Age out oldest entries, until there are (a) bo too-old entries left,
+// (b) we are under the max size of the cache and (c) we are under the
+// max bytes of a memory-bounded cache.
 func lruAge[K comparable, V any](lru *LRU[K, V], now time.Time) {
 	if lru.maxAge > 0 {
 		var done bool
@@ -51,8 +87,7 @@ func lruAge[K comparable, V any](lru *LRU[K, V], now time.Time) {
 				continue
 			}
 
-			drop := removeOldest(lru.keys)
-			delete(lru.m, drop)
+			lruRemove(lru, removeOldest(lru.keys), EventEvict)
 
 			if len(lru.m) == 0 {
 				done = true
@@ -62,34 +97,340 @@ func lruAge[K comparable, V any](lru *LRU[K, V], now time.Time) {
 
 	if lru.maxSize > 0 {
 		for len(lru.m) > lru.maxSize {
-			drop := removeOldest(lru.keys)
-			delete(lru.m, drop)
+			lruRemove(lru, removeOldest(lru.keys), EventEvict)
+		}
+	}
+
+	if lru.maxBytes > 0 {
+		for lru.bytes > lru.maxBytes && len(lru.m) > 0 {
+			lruRemove(lru, removeOldest(lru.keys), EventEvict)
 		}
 	}
 }
 
+// Remove a key from the cache, keeping the usage order and tag
+// index consistent, and notifying subscribers and the eviction
+// callback. Returns true if there was a value to remove. Must be
+// called with the lock held.
+func lruRemove[K comparable, V any](lru *LRU[K, V], k K, reason EventKind) bool {
+	old, ok := lru.m[k]
+	if !ok {
+		return false
+	}
+
+	delete(lru.m, k)
+	removeKey(lru.keys, k)
+	untagKey(&lru.tags, k)
+	if lru.index != nil {
+		lru.index.remove(k)
+	}
+	if lru.sizes != nil {
+		lru.bytes -= lru.sizes[k]
+		delete(lru.sizes, k)
+	}
+	if reason == EventEvict {
+		lru.stats.Evictions++
+	}
+	if len(lru.subs) > 0 {
+		emit(lru.subs, Event[K, V]{Kind: reason, Key: k, Old: old})
+	}
+	if lru.onEvict != nil {
+		lru.onEvict(k, old, reason)
+	}
+
+	return true
+}
+
+// Store a value with a (possibly empty) set of tags, notifying any
+// subscribers. Must be called with the lock held.
+func lruSet[K comparable, V any](lru *LRU[K, V], k K, v V, tags []string, now time.Time) {
+	old, existed := lru.m[k]
+	lru.m[k] = v
+	updateTimeMap(lru.keys, k, now)
+	tagKey(&lru.tags, k, tags)
+	if !existed && lru.index != nil {
+		lru.index.insert(k)
+	}
+	if lru.sizes != nil {
+		size := EstimateSize(k) + EstimateSize(v)
+		lru.bytes += size - lru.sizes[k]
+		lru.sizes[k] = size
+	}
+
+	if len(lru.subs) > 0 {
+		ev := Event[K, V]{Kind: EventSet, Key: k, New: v}
+		if existed {
+			ev.Kind = EventReplace
+			ev.Old = old
+		}
+		emit(lru.subs, ev)
+	}
+
+	// An entry that can never fit should not push everything else
+	// out on its way through.
+	if lru.maxBytes > 0 && lru.sizes[k] > lru.maxBytes {
+		lruRemove(lru, k, EventEvict)
+	}
+}
+
 // Set cached value for a specific key in an LRU map, uses a
 // syncronisation primitive so should be safe for concurrent use.
 func SetLRU[K comparable, V any](lru *LRU[K, V], k K, v V) {
 	lru.lock.Lock()
 	defer lru.lock.Unlock()
 
-	now := time.Now()
-	lru.m[k] = v
-	updateTimeMap(lru.keys, k, now)
+	now := clockNow(lru.clock)
+	lruSet(lru, k, v, nil, now)
+	lruAge(lru, now)
+}
+
+// Set cached value for a specific key in an LRU map, tagging it with
+// all passed-in tags. Setting a key replaces any tags it had before,
+// so a plain SetLRU removes all its tags.
+func SetTaggedLRU[K comparable, V any](lru *LRU[K, V], k K, v V, tags ...string) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	now := clockNow(lru.clock)
+	lruSet(lru, k, v, tags, now)
+	lruAge(lru, now)
+}
+
+// Remove all entries tagged with tag from an LRU map, returning the
+// number of entries removed.
+func InvalidateTagLRU[K comparable, V any](lru *LRU[K, V], tag string) int {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	var rv int
+	for _, k := range taggedKeys(&lru.tags, tag) {
+		if lruRemove(lru, k, EventInvalidate) {
+			rv++
+		}
+	}
+
+	return rv
+}
+
+// Set cached values for all keys in the passed-in map, taking the
+// lock once for the whole batch. Ageing out happens once all values
+// have been set.
+func SetManyLRU[K comparable, V any](lru *LRU[K, V], values map[K]V) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	now := clockNow(lru.clock)
+	for k, v := range values {
+		lruSet(lru, k, v, nil, now)
+	}
 	lruAge(lru, now)
 }
 
+// Look up a key, marking it as used if it exists. Must be called
+// with the lock held.
+func lruGet[K comparable, V any](lru *LRU[K, V], k K, now time.Time) (V, bool) {
+	rv, ok := lru.m[k]
+	if ok {
+		updateTimeMap(lru.keys, k, now)
+		lru.stats.Hits++
+	} else {
+		lru.stats.Misses++
+	}
+
+	return rv, ok
+}
+
+// Delete a key from an LRU map. The returned bool is true if the key
+// existed, otherwise false.
+func DeleteLRU[K comparable, V any](lru *LRU[K, V], k K) bool {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	return lruRemove(lru, k, EventDelete)
+}
+
+// Delete all entries in an LRU map for which f returns true,
+// returning the number of entries deleted. This looks at every entry
+// in the cache, with the cache locked.
+func DeleteFuncLRU[K comparable, V any](lru *LRU[K, V], f func(K, V) bool) int {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	var drop []K
+	for k, v := range lru.m {
+		if f(k, v) {
+			drop = append(drop, k)
+		}
+	}
+	for _, k := range drop {
+		lruRemove(lru, k, EventDelete)
+	}
+
+	return len(drop)
+}
+
+// Delete all entries whose key starts with prefix from a
+// string-keyed LRU map, returning the number of entries deleted.
+//
+// The first call builds a prefix index of all keys, which is then
+// kept up to date, so later calls only look at matching keys.
+func DeletePrefixLRU[V any](lru *LRU[string, V], prefix string) int {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	tree, ok := lru.index.(*radixTree)
+	if !ok {
+		tree = newRadixTree()
+		for k := range lru.m {
+			tree.insert(k)
+		}
+		lru.index = tree
+	}
+
+	drop := tree.withPrefix(prefix)
+	for _, k := range drop {
+		lruRemove(lru, k, EventDelete)
+	}
+
+	return len(drop)
+}
+
 // Get cached value for a specific key in an LRU map, uses a
 // synchronisation primitive. The returned bool is true if the key
-// existed, otherwise false.
+// existed, otherwise false. Entries older than the maximum age are
+// aged out first, so they are never returned.
 func GetLRU[K comparable, V any](lru *LRU[K, V], k K) (V, bool) {
 	lru.lock.Lock()
 	defer lru.lock.Unlock()
 
-	now := time.Now()
-	updateTimeMap(lru.keys, k, now)
+	now := clockNow(lru.clock)
+	lruAge(lru, now)
+	return lruGet(lru, k, now)
+}
 
-	rv, ok := lru.m[k]
-	return rv, ok
+// Get cached values for a number of keys in an LRU map, taking the
+// lock once for the whole batch. Only keys that exist in the cache
+// are present in the returned map.
+func GetManyLRU[K comparable, V any](lru *LRU[K, V], keys []K) map[K]V {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	now := clockNow(lru.clock)
+	lruAge(lru, now)
+	rv := make(map[K]V, len(keys))
+	for _, k := range keys {
+		if v, ok := lruGet(lru, k, now); ok {
+			rv[k] = v
+		}
+	}
+
+	return rv
+}
+
+// Get cached value for a specific key in an LRU map, calling the
+// loader to fill in the value if it is not in the cache. Concurrent
+// calls for the same missing key share a single call to the loader.
+//
+// Errors from the loader are returned as-is, and not cached.
+func GetOrLoadLRU[K comparable, V any](lru *LRU[K, V], k K, loader Loader[K, V]) (V, error) {
+	if v, ok := GetLRU(lru, k); ok {
+		return v, nil
+	}
+
+	return doFlight(&lru.flights, k, func() (V, error) {
+		v, err := loader(k)
+		if err == nil {
+			SetLRU(lru, k, v)
+		}
+		return v, err
+	})
+}
+
+// Get cached value for a specific key in an LRU map, calling the
+// loader to fill in the value if it is not in the cache. Concurrent
+// calls for the same missing key share a single call to the loader.
+//
+// If ctx is done while waiting for the loader, ctx.Err() is returned
+// straight away, but the load carries on for any other callers
+// waiting for it. The loader's context carries the values of the
+// context of the caller that started the load, but not its deadline,
+// and is only cancelled once all callers waiting for it have given up.
+func GetOrLoadLRUContext[K comparable, V any](ctx context.Context, lru *LRU[K, V], k K, loader ContextLoader[K, V]) (V, error) {
+	if v, ok := GetLRU(lru, k); ok {
+		return v, nil
+	}
+
+	return doFlightContext(ctx, &lru.flights, k, func(ctx context.Context) (V, error) {
+		v, err := loader(ctx, k)
+		if err == nil {
+			SetLRU(lru, k, v)
+		}
+		return v, err
+	})
+}
+
+// Get cached values for a number of keys in an LRU map. All keys not
+// in the cache are passed to the loader in a single call, and
+// whatever it returns is stored in the cache and merged into the
+// result.
+//
+// If the loader returns an error, the values found in the cache are
+// returned together with the error, and nothing is stored.
+func GetOrLoadManyLRU[K comparable, V any](lru *LRU[K, V], keys []K, loader BatchLoader[K, V]) (map[K]V, error) {
+	rv := GetManyLRU(lru, keys)
+	missing := missingKeys(keys, rv)
+	if len(missing) == 0 {
+		return rv, nil
+	}
+
+	loaded, err := loader(missing)
+	if err != nil {
+		return rv, err
+	}
+	SetManyLRU(lru, loaded)
+	for k, v := range loaded {
+		rv[k] = v
+	}
+
+	return rv, nil
+}
+
+// Return the usage statistics for an LRU map.
+func StatsLRU[K comparable, V any](lru *LRU[K, V]) Stats {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	rv := lru.stats
+	rv.Size = len(lru.m)
+	rv.Bytes = lru.bytes
+
+	return rv
+}
+
+// Subscribe to changes to an LRU map. Events are delivered on the
+// returned channel, which can hold up to size events before the
+// policy decides what happens to further events. Once ctx is done,
+// the subscription is cancelled and the channel closed.
+//
+// Note that entries are only aged out when the cache is used, so
+// eviction events are not delivered the moment an entry expires.
+func SubscribeLRU[K comparable, V any](ctx context.Context, lru *LRU[K, V], size int, policy OverflowPolicy) <-chan Event[K, V] {
+	return subscribe(&lru.lock, &lru.subs, ctx, size, policy)
+}
+
+// Set a callback to be called whenever an entry leaves an LRU map,
+// replacing any previous callback. A nil callback removes it.
+func SetEvictionCallbackLRU[K comparable, V any](lru *LRU[K, V], f EvictionCallback[K, V]) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	lru.onEvict = f
+}
+
+// Set the clock used by an LRU map. A nil clock means time.Now.
+func SetClockLRU[K comparable, V any](lru *LRU[K, V], clock Clock) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	lru.clock = clock
 }
@@ -1,9 +1,14 @@
 package cache
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	"time"
+
+	"github.com/vatine/goutils/maputils"
 )
 
 func TestAgeLRW(t *testing.T) {
@@ -106,3 +111,334 @@ func TestLRWSetAndGet(t *testing.T) {
 		}
 	}
 }
+
+func TestLRUSetAndGetMany(t *testing.T) {
+	lru, _ := NewLRUCache(0, "", 3, time.Second)
+
+	SetManyLRU(lru, map[int]string{10: "ten", 20: "twenty"})
+	if len(lru.m) != 2 {
+		t.Errorf("Want size 2, saw %d", len(lru.m))
+	}
+
+	got := GetManyLRU(lru, []int{10, 20, 30})
+	maputils.MapEqual(got, map[int]string{10: "ten", 20: "twenty"}, t)
+	if len(lru.keys.m) != 2 {
+		t.Errorf("Looking up a missing key changed the time map, now %d keys", len(lru.keys.m))
+	}
+
+	SetManyLRU(lru, map[int]string{30: "thirty", 40: "forty"})
+	if len(lru.m) != 3 {
+		t.Errorf("Want size 3, saw %d", len(lru.m))
+	}
+}
+
+func TestLRUGetOrLoadMany(t *testing.T) {
+	lru, _ := NewLRUCache(0, "", 5, time.Second)
+	SetLRU(lru, 10, "ten")
+
+	var calls int
+	var requested []int
+	loader := func(keys []int) (map[int]string, error) {
+		calls++
+		requested = keys
+		return map[int]string{20: "twenty"}, nil
+	}
+
+	got, err := GetOrLoadManyLRU(lru, []int{10, 20, 30, 20}, loader)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	maputils.MapEqual(got, map[int]string{10: "ten", 20: "twenty"}, t)
+	if calls != 1 {
+		t.Errorf("Want 1 loader call, saw %d", calls)
+	}
+	if len(requested) != 2 || requested[0] != 20 || requested[1] != 30 {
+		t.Errorf("Want loader called with [20 30], saw %v", requested)
+	}
+	if v, ok := GetLRU(lru, 20); !ok || v != "twenty" {
+		t.Errorf("Loaded value not stored, saw «%s», %v", v, ok)
+	}
+
+	_, err = GetOrLoadManyLRU(lru, []int{10, 20}, loader)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Loader called with no keys missing")
+	}
+
+	boom := errors.New("boom")
+	got, err = GetOrLoadManyLRU(lru, []int{10, 40}, func([]int) (map[int]string, error) {
+		return nil, boom
+	})
+	if err != boom {
+		t.Errorf("Want error %v, saw %v", boom, err)
+	}
+	maputils.MapEqual(got, map[int]string{10: "ten"}, t)
+}
+
+func TestLRUStats(t *testing.T) {
+	lru, _ := NewLRUCache(0, "", 2, time.Second)
+
+	SetLRU(lru, 10, "ten")
+	SetLRU(lru, 20, "twenty")
+	GetLRU(lru, 10)
+	GetLRU(lru, 30)
+	SetLRU(lru, 30, "thirty")
+	GetManyLRU(lru, []int{10, 20})
+
+	want := Stats{Hits: 2, Misses: 2, Evictions: 1, Size: 2}
+	if got := StatsLRU(lru); got != want {
+		t.Errorf("Want stats %+v, saw %+v", want, got)
+	}
+}
+
+func TestLRUGetOrLoad(t *testing.T) {
+	lru, _ := NewLRUCache(0, "", 5, time.Second)
+
+	var calls int
+	loader := func(k int) (string, error) {
+		calls++
+		if k < 0 {
+			return "", errors.New("negative")
+		}
+		return fmt.Sprint(k), nil
+	}
+
+	cases := []struct {
+		k     int
+		want  string
+		calls int
+		err   bool
+	}{
+		{10, "10", 1, false},
+		{10, "10", 1, false},
+		{-1, "", 2, true},
+		{-1, "", 3, true},
+		{20, "20", 4, false},
+	}
+
+	for ix, tc := range cases {
+		got, err := GetOrLoadLRU(lru, tc.k, loader)
+		if got != tc.want {
+			t.Errorf("Case #%d, want «%s», saw «%s»", ix, tc.want, got)
+		}
+		if (err != nil) != tc.err {
+			t.Errorf("Case #%d, unexpected error %v", ix, err)
+		}
+		if calls != tc.calls {
+			t.Errorf("Case #%d, want %d calls, saw %d", ix, tc.calls, calls)
+		}
+	}
+}
+
+func TestLRUDelete(t *testing.T) {
+	lru, _ := NewLRUCache(0, "", 5, time.Second)
+	SetLRU(lru, 10, "ten")
+	SetLRU(lru, 20, "twenty")
+
+	if !DeleteLRU(lru, 10) {
+		t.Errorf("Failed to delete existing key")
+	}
+	if DeleteLRU(lru, 10) {
+		t.Errorf("Deleted missing key")
+	}
+	if _, ok := GetLRU(lru, 10); ok {
+		t.Errorf("Deleted key still present")
+	}
+	if len(lru.m) != 1 || len(lru.keys.m) != 1 {
+		t.Errorf("Want 1 key left, saw %d values and %d keys", len(lru.m), len(lru.keys.m))
+	}
+}
+
+func TestLRUInvalidateTag(t *testing.T) {
+	lru, _ := NewLRUCache("", 0, 10, time.Minute)
+
+	removed := make(map[string]EventKind)
+	SetEvictionCallbackLRU(lru, func(k string, v int, reason EventKind) {
+		removed[k] = reason
+	})
+
+	SetTaggedLRU(lru, "t1:a", 1, "tenant1")
+	SetTaggedLRU(lru, "t1:b", 2, "tenant1", "shared")
+	SetTaggedLRU(lru, "t2:a", 3, "tenant2", "shared")
+	SetTaggedLRU(lru, "t1:c", 4, "tenant1")
+	SetLRU(lru, "t1:c", 5)
+
+	if n := InvalidateTagLRU(lru, "tenant1"); n != 2 {
+		t.Errorf("Want 2 entries invalidated, saw %d", n)
+	}
+	if len(lru.m) != 2 || len(lru.keys.m) != 2 {
+		t.Errorf("Want 2 entries left, saw %d values and %d keys", len(lru.m), len(lru.keys.m))
+	}
+	for _, k := range []string{"t1:a", "t1:b"} {
+		if removed[k] != EventInvalidate {
+			t.Errorf("Key %s, want callback with %v, saw %v", k, EventInvalidate, removed[k])
+		}
+	}
+	if _, ok := GetLRU(lru, "t1:c"); !ok {
+		t.Errorf("Re-set key lost when its old tag was invalidated")
+	}
+
+	if n := InvalidateTagLRU(lru, "shared"); n != 1 {
+		t.Errorf("Want 1 entry invalidated, saw %d", n)
+	}
+	if n := InvalidateTagLRU(lru, "tenant1"); n != 0 {
+		t.Errorf("Want no entries invalidated, saw %d", n)
+	}
+	if StatsLRU(lru).Evictions != 0 {
+		t.Errorf("Invalidations counted as evictions")
+	}
+}
+
+func TestLRUDeleteFunc(t *testing.T) {
+	lru, _ := NewLRUCache(0, "", 10, time.Minute)
+	for i := 1; i <= 6; i++ {
+		SetLRU(lru, i, fmt.Sprint(i))
+	}
+
+	n := DeleteFuncLRU(lru, func(k int, v string) bool {
+		return k%2 == 0 || v == "5"
+	})
+	if n != 4 {
+		t.Errorf("Want 4 entries deleted, saw %d", n)
+	}
+	maputils.MapEqual(lru.m, map[int]string{1: "1", 3: "3"}, t)
+	if len(lru.keys.m) != 2 {
+		t.Errorf("Want 2 keys left in time map, saw %d", len(lru.keys.m))
+	}
+}
+
+func TestLRUDeletePrefix(t *testing.T) {
+	lru, _ := NewLRUCache("", 0, 10, time.Minute)
+	SetLRU(lru, "user:123:name", 1)
+	SetLRU(lru, "user:123:mail", 2)
+	SetLRU(lru, "user:1234:name", 3)
+
+	if n := DeletePrefixLRU(lru, "user:123:"); n != 2 {
+		t.Errorf("Want 2 entries deleted, saw %d", n)
+	}
+
+	// The index is now set up, and must follow later changes.
+	SetLRU(lru, "user:123:age", 4)
+	SetLRU(lru, "user:5:name", 5)
+	DeleteLRU(lru, "user:5:name")
+	if n := DeletePrefixLRU(lru, "user:"); n != 2 {
+		t.Errorf("Want 2 entries deleted, saw %d", n)
+	}
+	if len(lru.m) != 0 || len(lru.keys.m) != 0 {
+		t.Errorf("Want empty cache, saw %d values and %d keys", len(lru.m), len(lru.keys.m))
+	}
+}
+
+func TestMemoryBoundedLRU(t *testing.T) {
+	if _, err := NewMemoryBoundedLRU("", "", 0, time.Minute); err != IncorrectlySpecified {
+		t.Errorf("Zero byte budget did not fail, saw %v", err)
+	}
+
+	// Each entry is a 16-byte string header for the key and the
+	// value, plus one byte of key and ten bytes of value.
+	lru, _ := NewMemoryBoundedLRU("", "", 100, 0)
+	value := "0123456789"
+
+	SetLRU(lru, "a", value)
+	SetLRU(lru, "b", value)
+	if got := StatsLRU(lru).Bytes; got != 86 {
+		t.Errorf("Want 86 bytes, saw %d", got)
+	}
+
+	SetLRU(lru, "c", value)
+	if _, ok := lru.m["a"]; ok {
+		t.Errorf("Oldest entry not evicted when over budget")
+	}
+	if got := StatsLRU(lru).Bytes; got != 86 {
+		t.Errorf("Want 86 bytes, saw %d", got)
+	}
+
+	SetLRU(lru, "c", "")
+	DeleteLRU(lru, "b")
+	if got := StatsLRU(lru).Bytes; got != 33 {
+		t.Errorf("Want 33 bytes, saw %d", got)
+	}
+
+	SetLRU(lru, "huge", string(make([]byte, 200)))
+	if len(lru.m) != 1 {
+		t.Errorf("Oversized entry left %d entries", len(lru.m))
+	}
+	if got := StatsLRU(lru).Bytes; got != 33 {
+		t.Errorf("Want 33 bytes, saw %d", got)
+	}
+}
+
+func TestMemoryBoundedLRUOversized(t *testing.T) {
+	value := "0123456789"
+	values := map[string]string{
+		"b":    value,
+		"huge": string(make([]byte, 200)),
+		"c":    value,
+	}
+
+	// Map order is random, so try a few times for the oversized
+	// entry to land somewhere other than last.
+	for i := 0; i < 10; i++ {
+		lru, _ := NewMemoryBoundedLRU("", "", 100, 0)
+		SetManyLRU(lru, values)
+
+		got := GetManyLRU(lru, []string{"b", "c", "huge"})
+		if len(got) != 2 {
+			t.Fatalf("Want b and c kept, saw %d entries", len(got))
+		}
+		if got := StatsLRU(lru).Bytes; got != 86 {
+			t.Fatalf("Want 86 bytes, saw %d", got)
+		}
+	}
+}
+
+func TestLRUGetOrLoadContext(t *testing.T) {
+	lru, _ := NewLRUCache(0, "", 5, time.Second)
+
+	v, err := GetOrLoadLRUContext(context.Background(), lru, 10, func(ctx context.Context, k int) (string, error) {
+		return fmt.Sprint(k), nil
+	})
+	if v != "10" || err != nil {
+		t.Errorf("Want «10»/nil, saw «%s»/%v", v, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = GetOrLoadLRUContext(ctx, lru, 20, func(ctx context.Context, k int) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Want context.DeadlineExceeded, saw %v", err)
+	}
+	if _, ok := GetLRU(lru, 20); ok {
+		t.Errorf("Failed load stored a value")
+	}
+}
+
+func TestLRUAgeOnRead(t *testing.T) {
+	lru, _ := NewLRUCache("", 0, 0, time.Minute)
+	now := time.Unix(1000, 0)
+	SetClockLRU(lru, func() time.Time { return now })
+
+	// Reads keep an entry alive, as long as they come often enough.
+	SetLRU(lru, "a", 1)
+	for i := 0; i < 3; i++ {
+		now = now.Add(40 * time.Second)
+		if _, ok := GetLRU(lru, "a"); !ok {
+			t.Errorf("Read #%d, entry aged out despite recent use", i)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := GetLRU(lru, "a"); ok {
+		t.Errorf("Idle entry returned after its max age")
+	}
+	SetLRU(lru, "b", 2)
+	now = now.Add(2 * time.Minute)
+	if got := GetManyLRU(lru, []string{"b"}); len(got) != 0 {
+		t.Errorf("Expired entry returned, %v", got)
+	}
+}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -17,6 +18,13 @@ type LRW[K comparable, V any] struct {
 	keys    *cacheTimeMap[K]
 	maxSize int
 	maxAge  time.Duration
+	stats   Stats
+	flights flightGroup[K, V]
+	subs    []*subscriber[K, V]
+	onEvict EvictionCallback[K, V]
+	tags    tagIndex[K]
+	index   keyIndex[K]
+	clock   Clock
 }
 
 // Return a new Least Recently Written (LRW) cache.
@@ -51,8 +59,7 @@ func lrwAge[K comparable, V any](lrw *LRW[K, V], now time.Time) {
 				continue
 			}
 
-			drop := removeOldest(lrw.keys)
-			delete(lrw.m, drop)
+			lrwRemove(lrw, removeOldest(lrw.keys), EventEvict)
 
 			if len(lrw.m) == 0 {
 				done = true
@@ -62,31 +69,315 @@ func lrwAge[K comparable, V any](lrw *LRW[K, V], now time.Time) {
 
 	if lrw.maxSize > 0 {
 		for len(lrw.m) > lrw.maxSize {
-			drop := removeOldest(lrw.keys)
-			delete(lrw.m, drop)
+			lrwRemove(lrw, removeOldest(lrw.keys), EventEvict)
 		}
 	}
 }
 
+// Remove a key from the cache, keeping the usage order and tag
+// index consistent, and notifying subscribers and the eviction
+// callback. Returns true if there was a value to remove. Must be
+// called with the lock held.
+func lrwRemove[K comparable, V any](lrw *LRW[K, V], k K, reason EventKind) bool {
+	old, ok := lrw.m[k]
+	if !ok {
+		return false
+	}
+
+	delete(lrw.m, k)
+	removeKey(lrw.keys, k)
+	untagKey(&lrw.tags, k)
+	if lrw.index != nil {
+		lrw.index.remove(k)
+	}
+	if reason == EventEvict {
+		lrw.stats.Evictions++
+	}
+	if len(lrw.subs) > 0 {
+		emit(lrw.subs, Event[K, V]{Kind: reason, Key: k, Old: old})
+	}
+	if lrw.onEvict != nil {
+		lrw.onEvict(k, old, reason)
+	}
+
+	return true
+}
+
+// Store a value with a (possibly empty) set of tags, notifying any
+// subscribers. Must be called with the lock held.
+func lrwSet[K comparable, V any](lrw *LRW[K, V], k K, v V, tags []string, now time.Time) {
+	old, existed := lrw.m[k]
+	lrw.m[k] = v
+	updateTimeMap(lrw.keys, k, now)
+	tagKey(&lrw.tags, k, tags)
+	if !existed && lrw.index != nil {
+		lrw.index.insert(k)
+	}
+
+	if len(lrw.subs) > 0 {
+		ev := Event[K, V]{Kind: EventSet, Key: k, New: v}
+		if existed {
+			ev.Kind = EventReplace
+			ev.Old = old
+		}
+		emit(lrw.subs, ev)
+	}
+}
+
 // Set cached value for a specific key in an LRW map, uses a
 // syncronisation primitive so should be safe for concurrent use.
 func SetLRW[K comparable, V any](lrw *LRW[K, V], k K, v V) {
 	lrw.lock.Lock()
 	defer lrw.lock.Unlock()
 
-	now := time.Now()
-	lrw.m[k] = v
-	updateTimeMap(lrw.keys, k, now)
+	now := clockNow(lrw.clock)
+	lrwSet(lrw, k, v, nil, now)
+	lrwAge(lrw, now)
+}
+
+// Set cached value for a specific key in an LRW map, tagging it with
+// all passed-in tags. Setting a key replaces any tags it had before,
+// so a plain SetLRW removes all its tags.
+func SetTaggedLRW[K comparable, V any](lrw *LRW[K, V], k K, v V, tags ...string) {
+	lrw.lock.Lock()
+	defer lrw.lock.Unlock()
+
+	now := clockNow(lrw.clock)
+	lrwSet(lrw, k, v, tags, now)
+	lrwAge(lrw, now)
+}
+
+// Remove all entries tagged with tag from an LRW map, returning the
+// number of entries removed.
+func InvalidateTagLRW[K comparable, V any](lrw *LRW[K, V], tag string) int {
+	lrw.lock.Lock()
+	defer lrw.lock.Unlock()
+
+	var rv int
+	for _, k := range taggedKeys(&lrw.tags, tag) {
+		if lrwRemove(lrw, k, EventInvalidate) {
+			rv++
+		}
+	}
+
+	return rv
+}
+
+// Set cached values for all keys in the passed-in map, taking the
+// lock once for the whole batch. Ageing out happens once all values
+// have been set.
+func SetManyLRW[K comparable, V any](lrw *LRW[K, V], values map[K]V) {
+	lrw.lock.Lock()
+	defer lrw.lock.Unlock()
+
+	now := clockNow(lrw.clock)
+	for k, v := range values {
+		lrwSet(lrw, k, v, nil, now)
+	}
 	lrwAge(lrw, now)
 }
 
+// Look up a key, counting the hit or miss. Must be called with the
+// lock held.
+func lrwGet[K comparable, V any](lrw *LRW[K, V], k K) (V, bool) {
+	rv, ok := lrw.m[k]
+	if ok {
+		lrw.stats.Hits++
+	} else {
+		lrw.stats.Misses++
+	}
+
+	return rv, ok
+}
+
+// Delete a key from an LRW map. The returned bool is true if the key
+// existed, otherwise false.
+func DeleteLRW[K comparable, V any](lrw *LRW[K, V], k K) bool {
+	lrw.lock.Lock()
+	defer lrw.lock.Unlock()
+
+	return lrwRemove(lrw, k, EventDelete)
+}
+
+// Delete all entries in an LRW map for which f returns true,
+// returning the number of entries deleted. This looks at every entry
+// in the cache, with the cache locked.
+func DeleteFuncLRW[K comparable, V any](lrw *LRW[K, V], f func(K, V) bool) int {
+	lrw.lock.Lock()
+	defer lrw.lock.Unlock()
+
+	var drop []K
+	for k, v := range lrw.m {
+		if f(k, v) {
+			drop = append(drop, k)
+		}
+	}
+	for _, k := range drop {
+		lrwRemove(lrw, k, EventDelete)
+	}
+
+	return len(drop)
+}
+
+// Delete all entries whose key starts with prefix from a
+// string-keyed LRW map, returning the number of entries deleted.
+//
+// The first call builds a prefix index of all keys, which is then
+// kept up to date, so later calls only look at matching keys.
+func DeletePrefixLRW[V any](lrw *LRW[string, V], prefix string) int {
+	lrw.lock.Lock()
+	defer lrw.lock.Unlock()
+
+	tree, ok := lrw.index.(*radixTree)
+	if !ok {
+		tree = newRadixTree()
+		for k := range lrw.m {
+			tree.insert(k)
+		}
+		lrw.index = tree
+	}
+
+	drop := tree.withPrefix(prefix)
+	for _, k := range drop {
+		lrwRemove(lrw, k, EventDelete)
+	}
+
+	return len(drop)
+}
+
 // Get cached value for a specific key in an LRW map, uses a
 // synchronisation primitive. The returned bool is true if the key
-// existed, otherwise false.
+// existed, otherwise false. Entries older than the maximum age are
+// aged out first, so they are never returned.
 func GetLRW[K comparable, V any](lrw *LRW[K, V], k K) (V, bool) {
 	lrw.lock.Lock()
 	defer lrw.lock.Unlock()
 
-	rv, ok := lrw.m[k]
-	return rv, ok
+	lrwAge(lrw, clockNow(lrw.clock))
+	return lrwGet(lrw, k)
+}
+
+// Get cached values for a number of keys in an LRW map, taking the
+// lock once for the whole batch. Only keys that exist in the cache
+// are present in the returned map.
+func GetManyLRW[K comparable, V any](lrw *LRW[K, V], keys []K) map[K]V {
+	lrw.lock.Lock()
+	defer lrw.lock.Unlock()
+
+	lrwAge(lrw, clockNow(lrw.clock))
+	rv := make(map[K]V, len(keys))
+	for _, k := range keys {
+		if v, ok := lrwGet(lrw, k); ok {
+			rv[k] = v
+		}
+	}
+
+	return rv
+}
+
+// Get cached value for a specific key in an LRW map, calling the
+// loader to fill in the value if it is not in the cache. Concurrent
+// calls for the same missing key share a single call to the loader.
+//
+// Errors from the loader are returned as-is, and not cached.
+func GetOrLoadLRW[K comparable, V any](lrw *LRW[K, V], k K, loader Loader[K, V]) (V, error) {
+	if v, ok := GetLRW(lrw, k); ok {
+		return v, nil
+	}
+
+	return doFlight(&lrw.flights, k, func() (V, error) {
+		v, err := loader(k)
+		if err == nil {
+			SetLRW(lrw, k, v)
+		}
+		return v, err
+	})
+}
+
+// Get cached value for a specific key in an LRW map, calling the
+// loader to fill in the value if it is not in the cache. Concurrent
+// calls for the same missing key share a single call to the loader.
+//
+// If ctx is done while waiting for the loader, ctx.Err() is returned
+// straight away, but the load carries on for any other callers
+// waiting for it. The loader's context carries the values of the
+// context of the caller that started the load, but not its deadline,
+// and is only cancelled once all callers waiting for it have given up.
+func GetOrLoadLRWContext[K comparable, V any](ctx context.Context, lrw *LRW[K, V], k K, loader ContextLoader[K, V]) (V, error) {
+	if v, ok := GetLRW(lrw, k); ok {
+		return v, nil
+	}
+
+	return doFlightContext(ctx, &lrw.flights, k, func(ctx context.Context) (V, error) {
+		v, err := loader(ctx, k)
+		if err == nil {
+			SetLRW(lrw, k, v)
+		}
+		return v, err
+	})
+}
+
+// Get cached values for a number of keys in an LRW map. All keys not
+// in the cache are passed to the loader in a single call, and
+// whatever it returns is stored in the cache and merged into the
+// result.
+//
+// If the loader returns an error, the values found in the cache are
+// returned together with the error, and nothing is stored.
+func GetOrLoadManyLRW[K comparable, V any](lrw *LRW[K, V], keys []K, loader BatchLoader[K, V]) (map[K]V, error) {
+	rv := GetManyLRW(lrw, keys)
+	missing := missingKeys(keys, rv)
+	if len(missing) == 0 {
+		return rv, nil
+	}
+
+	loaded, err := loader(missing)
+	if err != nil {
+		return rv, err
+	}
+	SetManyLRW(lrw, loaded)
+	for k, v := range loaded {
+		rv[k] = v
+	}
+
+	return rv, nil
+}
+
+// Return the usage statistics for an LRW map.
+func StatsLRW[K comparable, V any](lrw *LRW[K, V]) Stats {
+	lrw.lock.Lock()
+	defer lrw.lock.Unlock()
+
+	rv := lrw.stats
+	rv.Size = len(lrw.m)
+
+	return rv
+}
+
+// Subscribe to changes to an LRW map. Events are delivered on the
+// returned channel, which can hold up to size events before the
+// policy decides what happens to further events. Once ctx is done,
+// the subscription is cancelled and the channel closed.
+//
+// Note that entries are only aged out when the cache is used, so
+// eviction events are not delivered the moment an entry expires.
+func SubscribeLRW[K comparable, V any](ctx context.Context, lrw *LRW[K, V], size int, policy OverflowPolicy) <-chan Event[K, V] {
+	return subscribe(&lrw.lock, &lrw.subs, ctx, size, policy)
+}
+
+// Set a callback to be called whenever an entry leaves an LRW map,
+// replacing any previous callback. A nil callback removes it.
+func SetEvictionCallbackLRW[K comparable, V any](lrw *LRW[K, V], f EvictionCallback[K, V]) {
+	lrw.lock.Lock()
+	defer lrw.lock.Unlock()
+
+	lrw.onEvict = f
+}
+
+// Set the clock used by an LRW map. A nil clock means time.Now.
+func SetClockLRW[K comparable, V any](lrw *LRW[K, V], clock Clock) {
+	lrw.lock.Lock()
+	defer lrw.lock.Unlock()
+
+	lrw.clock = clock
 }
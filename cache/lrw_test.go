@@ -1,9 +1,14 @@
 package cache
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	"time"
+
+	"github.com/vatine/goutils/maputils"
 )
 
 func TestAgeLRU(t *testing.T) {
@@ -106,3 +111,264 @@ func TestLRUSetAndGet(t *testing.T) {
 		}
 	}
 }
+
+func TestLRWSetAndGetMany(t *testing.T) {
+	lrw, _ := NewLRWCache(0, "", 3, time.Second)
+
+	SetManyLRW(lrw, map[int]string{10: "ten", 20: "twenty"})
+	if len(lrw.m) != 2 {
+		t.Errorf("Want size 2, saw %d", len(lrw.m))
+	}
+
+	got := GetManyLRW(lrw, []int{10, 20, 30})
+	maputils.MapEqual(got, map[int]string{10: "ten", 20: "twenty"}, t)
+	if len(lrw.keys.m) != 2 {
+		t.Errorf("Looking up keys changed the time map, now %d keys", len(lrw.keys.m))
+	}
+
+	SetManyLRW(lrw, map[int]string{30: "thirty", 40: "forty"})
+	if len(lrw.m) != 3 {
+		t.Errorf("Want size 3, saw %d", len(lrw.m))
+	}
+}
+
+func TestLRWGetOrLoadMany(t *testing.T) {
+	lrw, _ := NewLRWCache(0, "", 5, time.Second)
+	SetLRW(lrw, 10, "ten")
+
+	var calls int
+	var requested []int
+	loader := func(keys []int) (map[int]string, error) {
+		calls++
+		requested = keys
+		return map[int]string{20: "twenty"}, nil
+	}
+
+	got, err := GetOrLoadManyLRW(lrw, []int{10, 20, 30, 20}, loader)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	maputils.MapEqual(got, map[int]string{10: "ten", 20: "twenty"}, t)
+	if calls != 1 {
+		t.Errorf("Want 1 loader call, saw %d", calls)
+	}
+	if len(requested) != 2 || requested[0] != 20 || requested[1] != 30 {
+		t.Errorf("Want loader called with [20 30], saw %v", requested)
+	}
+	if v, ok := GetLRW(lrw, 20); !ok || v != "twenty" {
+		t.Errorf("Loaded value not stored, saw «%s», %v", v, ok)
+	}
+
+	_, err = GetOrLoadManyLRW(lrw, []int{10, 20}, loader)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Loader called with no keys missing")
+	}
+
+	boom := errors.New("boom")
+	got, err = GetOrLoadManyLRW(lrw, []int{10, 40}, func([]int) (map[int]string, error) {
+		return nil, boom
+	})
+	if err != boom {
+		t.Errorf("Want error %v, saw %v", boom, err)
+	}
+	maputils.MapEqual(got, map[int]string{10: "ten"}, t)
+}
+
+func TestLRWStats(t *testing.T) {
+	lrw, _ := NewLRWCache(0, "", 2, time.Second)
+
+	SetLRW(lrw, 10, "ten")
+	SetLRW(lrw, 20, "twenty")
+	GetLRW(lrw, 10)
+	GetLRW(lrw, 30)
+	SetLRW(lrw, 30, "thirty")
+	GetManyLRW(lrw, []int{10, 20})
+
+	want := Stats{Hits: 2, Misses: 2, Evictions: 1, Size: 2}
+	if got := StatsLRW(lrw); got != want {
+		t.Errorf("Want stats %+v, saw %+v", want, got)
+	}
+}
+
+func TestLRWGetOrLoad(t *testing.T) {
+	lrw, _ := NewLRWCache(0, "", 5, time.Second)
+
+	var calls int
+	loader := func(k int) (string, error) {
+		calls++
+		if k < 0 {
+			return "", errors.New("negative")
+		}
+		return fmt.Sprint(k), nil
+	}
+
+	cases := []struct {
+		k     int
+		want  string
+		calls int
+		err   bool
+	}{
+		{10, "10", 1, false},
+		{10, "10", 1, false},
+		{-1, "", 2, true},
+		{-1, "", 3, true},
+		{20, "20", 4, false},
+	}
+
+	for ix, tc := range cases {
+		got, err := GetOrLoadLRW(lrw, tc.k, loader)
+		if got != tc.want {
+			t.Errorf("Case #%d, want «%s», saw «%s»", ix, tc.want, got)
+		}
+		if (err != nil) != tc.err {
+			t.Errorf("Case #%d, unexpected error %v", ix, err)
+		}
+		if calls != tc.calls {
+			t.Errorf("Case #%d, want %d calls, saw %d", ix, tc.calls, calls)
+		}
+	}
+}
+
+func TestLRWDelete(t *testing.T) {
+	lrw, _ := NewLRWCache(0, "", 5, time.Second)
+	SetLRW(lrw, 10, "ten")
+	SetLRW(lrw, 20, "twenty")
+
+	if !DeleteLRW(lrw, 10) {
+		t.Errorf("Failed to delete existing key")
+	}
+	if DeleteLRW(lrw, 10) {
+		t.Errorf("Deleted missing key")
+	}
+	if _, ok := GetLRW(lrw, 10); ok {
+		t.Errorf("Deleted key still present")
+	}
+	if len(lrw.m) != 1 || len(lrw.keys.m) != 1 {
+		t.Errorf("Want 1 key left, saw %d values and %d keys", len(lrw.m), len(lrw.keys.m))
+	}
+}
+
+func TestLRWInvalidateTag(t *testing.T) {
+	lrw, _ := NewLRWCache("", 0, 10, time.Minute)
+
+	removed := make(map[string]EventKind)
+	SetEvictionCallbackLRW(lrw, func(k string, v int, reason EventKind) {
+		removed[k] = reason
+	})
+
+	SetTaggedLRW(lrw, "t1:a", 1, "tenant1")
+	SetTaggedLRW(lrw, "t1:b", 2, "tenant1", "shared")
+	SetTaggedLRW(lrw, "t2:a", 3, "tenant2", "shared")
+	SetTaggedLRW(lrw, "t1:c", 4, "tenant1")
+	SetLRW(lrw, "t1:c", 5)
+
+	if n := InvalidateTagLRW(lrw, "tenant1"); n != 2 {
+		t.Errorf("Want 2 entries invalidated, saw %d", n)
+	}
+	if len(lrw.m) != 2 || len(lrw.keys.m) != 2 {
+		t.Errorf("Want 2 entries left, saw %d values and %d keys", len(lrw.m), len(lrw.keys.m))
+	}
+	for _, k := range []string{"t1:a", "t1:b"} {
+		if removed[k] != EventInvalidate {
+			t.Errorf("Key %s, want callback with %v, saw %v", k, EventInvalidate, removed[k])
+		}
+	}
+	if _, ok := GetLRW(lrw, "t1:c"); !ok {
+		t.Errorf("Re-set key lost when its old tag was invalidated")
+	}
+
+	if n := InvalidateTagLRW(lrw, "shared"); n != 1 {
+		t.Errorf("Want 1 entry invalidated, saw %d", n)
+	}
+	if n := InvalidateTagLRW(lrw, "tenant1"); n != 0 {
+		t.Errorf("Want no entries invalidated, saw %d", n)
+	}
+	if StatsLRW(lrw).Evictions != 0 {
+		t.Errorf("Invalidations counted as evictions")
+	}
+}
+
+func TestLRWDeleteFunc(t *testing.T) {
+	lrw, _ := NewLRWCache(0, "", 10, time.Minute)
+	for i := 1; i <= 6; i++ {
+		SetLRW(lrw, i, fmt.Sprint(i))
+	}
+
+	n := DeleteFuncLRW(lrw, func(k int, v string) bool {
+		return k%2 == 0 || v == "5"
+	})
+	if n != 4 {
+		t.Errorf("Want 4 entries deleted, saw %d", n)
+	}
+	maputils.MapEqual(lrw.m, map[int]string{1: "1", 3: "3"}, t)
+	if len(lrw.keys.m) != 2 {
+		t.Errorf("Want 2 keys left in time map, saw %d", len(lrw.keys.m))
+	}
+}
+
+func TestLRWDeletePrefix(t *testing.T) {
+	lrw, _ := NewLRWCache("", 0, 10, time.Minute)
+	SetLRW(lrw, "user:123:name", 1)
+	SetLRW(lrw, "user:123:mail", 2)
+	SetLRW(lrw, "user:1234:name", 3)
+
+	if n := DeletePrefixLRW(lrw, "user:123:"); n != 2 {
+		t.Errorf("Want 2 entries deleted, saw %d", n)
+	}
+
+	// The index is now set up, and must follow later changes.
+	SetLRW(lrw, "user:123:age", 4)
+	SetLRW(lrw, "user:5:name", 5)
+	DeleteLRW(lrw, "user:5:name")
+	if n := DeletePrefixLRW(lrw, "user:"); n != 2 {
+		t.Errorf("Want 2 entries deleted, saw %d", n)
+	}
+	if len(lrw.m) != 0 || len(lrw.keys.m) != 0 {
+		t.Errorf("Want empty cache, saw %d values and %d keys", len(lrw.m), len(lrw.keys.m))
+	}
+}
+
+func TestLRWGetOrLoadContext(t *testing.T) {
+	lrw, _ := NewLRWCache(0, "", 5, time.Second)
+
+	v, err := GetOrLoadLRWContext(context.Background(), lrw, 10, func(ctx context.Context, k int) (string, error) {
+		return fmt.Sprint(k), nil
+	})
+	if v != "10" || err != nil {
+		t.Errorf("Want «10»/nil, saw «%s»/%v", v, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = GetOrLoadLRWContext(ctx, lrw, 20, func(ctx context.Context, k int) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Want context.DeadlineExceeded, saw %v", err)
+	}
+	if _, ok := GetLRW(lrw, 20); ok {
+		t.Errorf("Failed load stored a value")
+	}
+}
+
+func TestLRWAgeOnRead(t *testing.T) {
+	lrw, _ := NewLRWCache("", 0, 0, time.Minute)
+	now := time.Unix(1000, 0)
+	SetClockLRW(lrw, func() time.Time { return now })
+
+	SetLRW(lrw, "a", 1)
+	for i := 0; i < 3; i++ {
+		now = now.Add(20 * time.Second)
+		_, ok := GetLRW(lrw, "a")
+		if want := i < 2; ok != want {
+			t.Errorf("After %v, want present %v, saw %v", time.Duration(i+1)*20*time.Second, want, ok)
+		}
+	}
+	if got := GetManyLRW(lrw, []string{"a"}); len(got) != 0 {
+		t.Errorf("Expired entry returned, %v", got)
+	}
+}
@@ -0,0 +1,105 @@
+package cache
+
+// Wrap functions in an LRU cache, so that repeated calls with the
+// same argument only compute the result once.
+
+import (
+	"context"
+	"time"
+)
+
+// The default number of results kept by a memoized function.
+const DefaultMemoSize = 1024
+
+type memoConfig struct {
+	maxSize int
+	maxAge  time.Duration
+	clock   Clock
+}
+
+// An option for the Memoize family of functions.
+type MemoOption func(*memoConfig)
+
+// Set the maximum number of results kept. A non-positive size means
+// the number of results is only bounded by age.
+func MemoSize(n int) MemoOption {
+	return func(c *memoConfig) {
+		c.maxSize = n
+	}
+}
+
+// Set the maximum time since last use that a result is kept.
+func MemoMaxAge(d time.Duration) MemoOption {
+	return func(c *memoConfig) {
+		c.maxAge = d
+	}
+}
+
+// Set the clock used to age out results, mostly for tests.
+func MemoClock(c Clock) MemoOption {
+	return func(config *memoConfig) {
+		config.clock = c
+	}
+}
+
+// Build the backing cache. If the options leave the cache unbounded,
+// fall back to the default size.
+func memoCache[K comparable, V any](opts []MemoOption) *LRU[K, V] {
+	config := memoConfig{maxSize: DefaultMemoSize}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.maxSize < 1 && config.maxAge == 0 {
+		config.maxSize = DefaultMemoSize
+	}
+
+	var k K
+	var v V
+	lru, _ := NewLRUCache(k, v, config.maxSize, config.maxAge)
+	if config.clock != nil {
+		SetClockLRU(lru, config.clock)
+	}
+
+	return lru
+}
+
+// Memoize a function, returning a function that behaves the same, but
+// only calls f once per argument for as long as the result stays in
+// the cache. Errors are not cached, and concurrent calls with the same
+// argument share a single call to f.
+func Memoize[K comparable, V any](f func(K) (V, error), opts ...MemoOption) func(K) (V, error) {
+	return MemoizeKeyed(f, func(k K) K { return k }, opts...)
+}
+
+// Memoize a function taking an argument that can not be used as a
+// cache key, or stands in for several arguments. The key function
+// derives the cache key from the argument.
+func MemoizeKeyed[A any, K comparable, V any](f func(A) (V, error), key func(A) K, opts ...MemoOption) func(A) (V, error) {
+	lru := memoCache[K, V](opts)
+
+	return func(a A) (V, error) {
+		return GetOrLoadLRU(lru, key(a), func(K) (V, error) {
+			return f(a)
+		})
+	}
+}
+
+// Memoize a context-aware function. A call whose context is done
+// returns straight away, without cancelling the computation for
+// other calls waiting on it; see GetOrLoadLRUContext for the context
+// passed to f.
+func MemoizeContext[K comparable, V any](f func(context.Context, K) (V, error), opts ...MemoOption) func(context.Context, K) (V, error) {
+	return MemoizeKeyedContext(f, func(k K) K { return k }, opts...)
+}
+
+// Memoize a context-aware function, deriving the cache key from the
+// argument using the key function.
+func MemoizeKeyedContext[A any, K comparable, V any](f func(context.Context, A) (V, error), key func(A) K, opts ...MemoOption) func(context.Context, A) (V, error) {
+	lru := memoCache[K, V](opts)
+
+	return func(ctx context.Context, a A) (V, error) {
+		return GetOrLoadLRUContext(ctx, lru, key(a), func(ctx context.Context, _ K) (V, error) {
+			return f(ctx, a)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoize(t *testing.T) {
+	var calls int
+	square := Memoize(func(n int) (int, error) {
+		calls++
+		if n < 0 {
+			return 0, errors.New("negative")
+		}
+		return n * n, nil
+	}, MemoSize(2))
+
+	cases := []struct {
+		n     int
+		want  int
+		calls int
+		err   bool
+	}{
+		{3, 9, 1, false},
+		{3, 9, 1, false},
+		{4, 16, 2, false},
+		{-1, 0, 3, true},
+		{-1, 0, 4, true},
+		{5, 25, 5, false},
+		{3, 9, 6, false},
+	}
+
+	for ix, tc := range cases {
+		got, err := square(tc.n)
+		if got != tc.want {
+			t.Errorf("Case #%d, want %d, saw %d", ix, tc.want, got)
+		}
+		if (err != nil) != tc.err {
+			t.Errorf("Case #%d, unexpected error %v", ix, err)
+		}
+		if calls != tc.calls {
+			t.Errorf("Case #%d, want %d calls, saw %d", ix, tc.calls, calls)
+		}
+	}
+}
+
+func TestMemoizeSingleFlight(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	slow := Memoize(func(s string) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return s + s, nil
+	})
+
+	var wg sync.WaitGroup
+	results := make([]string, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(ix int) {
+			defer wg.Done()
+			results[ix], _ = slow("ab")
+		}(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Want 1 call, saw %d", calls)
+	}
+	for ix, r := range results {
+		if r != "abab" {
+			t.Errorf("Result #%d, want «abab», saw «%s»", ix, r)
+		}
+	}
+}
+
+type point struct {
+	x, y int
+}
+
+func TestMemoizeKeyedContext(t *testing.T) {
+	var calls int
+	type ctxKey struct{}
+	add := MemoizeKeyedContext(func(ctx context.Context, p point) (string, error) {
+		calls++
+		return fmt.Sprintf("%v:%d", ctx.Value(ctxKey{}), p.x+p.y), nil
+	}, func(p point) string {
+		return fmt.Sprintf("%d,%d", p.x, p.y)
+	}, MemoMaxAge(time.Minute))
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "first")
+	got, _ := add(ctx, point{1, 2})
+	if got != "first:3" {
+		t.Errorf("Unexpected result «%s»", got)
+	}
+	got, _ = add(context.Background(), point{1, 2})
+	if got != "first:3" || calls != 1 {
+		t.Errorf("Result not memoized, saw «%s» after %d calls", got, calls)
+	}
+	add(ctx, point{2, 1})
+	if calls != 2 {
+		t.Errorf("Want 2 calls, saw %d", calls)
+	}
+}
+
+func TestMemoizeMaxAge(t *testing.T) {
+	now := time.Unix(1000, 0)
+	calls := 0
+	double := Memoize(func(n int) (int, error) {
+		calls++
+		return 2 * n, nil
+	}, MemoMaxAge(time.Minute), MemoClock(func() time.Time { return now }))
+
+	double(1)
+	now = now.Add(30 * time.Second)
+	double(1)
+	if calls != 1 {
+		t.Errorf("Want 1 call within the max age, saw %d", calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if v, _ := double(1); v != 2 {
+		t.Errorf("Want 2, saw %d", v)
+	}
+	if calls != 2 {
+		t.Errorf("Want 2 calls after idling past the max age, saw %d", calls)
+	}
+}
@@ -0,0 +1,138 @@
+package metrics
+
+// Export cache statistics in the Prometheus text exposition format,
+// using nothing but the standard library.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vatine/goutils/cache"
+)
+
+// Extra labels to attach to all series for a cache.
+type Labels map[string]string
+
+type source struct {
+	name   string
+	labels Labels
+	stats  func() cache.Stats
+}
+
+// An Exporter collects a number of caches and renders their
+// statistics on request. It implements http.Handler, so can be
+// mounted directly on a "/metrics" path.
+type Exporter struct {
+	lock      sync.Mutex
+	namespace string
+	sources   []source
+}
+
+type family struct {
+	suffix string
+	kind   string
+	help   string
+	value  func(cache.Stats) string
+}
+
+var families = []family{
+	{"hits_total", "counter", "Number of cache lookups that found a value.", func(s cache.Stats) string { return fmt.Sprint(s.Hits) }},
+	{"misses_total", "counter", "Number of cache lookups that found no value.", func(s cache.Stats) string { return fmt.Sprint(s.Misses) }},
+	{"evictions_total", "counter", "Number of entries aged out of the cache.", func(s cache.Stats) string { return fmt.Sprint(s.Evictions) }},
+	{"entries", "gauge", "Number of entries currently in the cache.", func(s cache.Stats) string { return fmt.Sprint(s.Size) }},
+}
+
+// Create a new exporter. All metric names will be prefixed by the
+// namespace (if non-empty) and "cache_".
+func NewExporter(namespace string) *Exporter {
+	return &Exporter{namespace: namespace}
+}
+
+// Add a source of cache statistics, under a given name. The name is
+// exported as the "cache" label, any extra labels are added to all
+// series for this cache.
+func Add(e *Exporter, name string, labels Labels, stats func() cache.Stats) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.sources = append(e.sources, source{name: name, labels: labels, stats: stats})
+}
+
+// Add an LRU cache to an exporter.
+func AddLRU[K comparable, V any](e *Exporter, name string, labels Labels, lru *cache.LRU[K, V]) {
+	Add(e, name, labels, func() cache.Stats { return cache.StatsLRU(lru) })
+}
+
+// Add an LRW cache to an exporter.
+func AddLRW[K comparable, V any](e *Exporter, name string, labels Labels, lrw *cache.LRW[K, V]) {
+	Add(e, name, labels, func() cache.Stats { return cache.StatsLRW(lrw) })
+}
+
+// Escape a label value as required by the exposition format.
+func escape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+// Render the label set for a source, with the label names sorted to
+// give a stable output.
+func labelString(src source) string {
+	names := make([]string, 0, len(src.labels))
+	for name := range src.labels {
+		if name != "cache" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	parts := []string{fmt.Sprintf(`cache="%s"`, escape(src.name))}
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, name, escape(src.labels[name])))
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Write the current statistics for all caches to w.
+func (e *Exporter) WriteTo(w io.Writer) (int64, error) {
+	e.lock.Lock()
+	sources := make([]source, len(e.sources))
+	copy(sources, e.sources)
+	e.lock.Unlock()
+
+	stats := make([]cache.Stats, len(sources))
+	labels := make([]string, len(sources))
+	for ix, src := range sources {
+		stats[ix] = src.stats()
+		labels[ix] = labelString(src)
+	}
+
+	prefix := "cache_"
+	if e.namespace != "" {
+		prefix = e.namespace + "_" + prefix
+	}
+
+	var buf bytes.Buffer
+	for _, f := range families {
+		name := prefix + f.suffix
+		fmt.Fprintf(&buf, "# HELP %s %s\n", name, f.help)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", name, f.kind)
+		for ix := range sources {
+			fmt.Fprintf(&buf, "%s%s %s\n", name, labels[ix], f.value(stats[ix]))
+		}
+	}
+
+	return buf.WriteTo(w)
+}
+
+// Serve the statistics for all caches.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.WriteTo(w)
+}
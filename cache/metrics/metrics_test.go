@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vatine/goutils/cache"
+)
+
+func TestExport(t *testing.T) {
+	lru, _ := cache.NewLRUCache("", 0, 1, time.Minute)
+	cache.SetLRU(lru, "a", 1)
+	cache.SetLRU(lru, "b", 2)
+	cache.GetLRU(lru, "b")
+	cache.GetLRU(lru, "c")
+
+	lrw, _ := cache.NewLRWCache(0, "", 5, time.Minute)
+
+	e := NewExporter("app")
+	AddLRU(e, "users", Labels{"region": "eu", "az": `a"1`}, lru)
+	AddLRW(e, "config", nil, lrw)
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %s", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	text := string(body)
+
+	want := []string{
+		"# TYPE app_cache_hits_total counter\n",
+		"# TYPE app_cache_entries gauge\n",
+		`app_cache_hits_total{cache="users",az="a\"1",region="eu"} 1` + "\n",
+		`app_cache_misses_total{cache="users",az="a\"1",region="eu"} 1` + "\n",
+		`app_cache_evictions_total{cache="users",az="a\"1",region="eu"} 1` + "\n",
+		`app_cache_entries{cache="users",az="a\"1",region="eu"} 1` + "\n",
+		`app_cache_entries{cache="config"} 0` + "\n",
+	}
+	for _, w := range want {
+		if !strings.Contains(text, w) {
+			t.Errorf("Output does not contain %q, saw:\n%s", w, text)
+		}
+	}
+}
+
+func TestNoNamespace(t *testing.T) {
+	e := NewExporter("")
+	Add(e, "x", nil, func() cache.Stats { return cache.Stats{Hits: 3} })
+
+	var sb strings.Builder
+	e.WriteTo(&sb)
+	if !strings.Contains(sb.String(), `cache_hits_total{cache="x"} 3`) {
+		t.Errorf("Unexpected output:\n%s", sb.String())
+	}
+}
@@ -0,0 +1,207 @@
+package peers
+
+// A peer-aware cache layer, in the style of groupcache. A number of
+// replicas each run a Pool, and agree on the owner of every key by
+// consistent hashing. Values are loaded (and cached) on the owning
+// replica; other replicas fetch them from the owner over HTTP and
+// keep a small local copy of keys they ask for.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vatine/goutils/cache"
+)
+
+// The path prefix peers serve values on.
+const DefaultBasePath = "/_goutils_cache/"
+
+// The default time a copy of a key owned by a peer is kept.
+const DefaultHotAge = time.Minute
+
+// A Getter loads the value for a key, on the replica owning it.
+type Getter func(ctx context.Context, key string) ([]byte, error)
+
+var UnknownGroup = errors.New("unknown cache group")
+
+// A Pool is the local replica's view of all peers. It serves the
+// values for keys it owns to other peers, and should be mounted on
+// DefaultBasePath.
+type Pool struct {
+	self   string
+	client *http.Client
+
+	lock   sync.RWMutex
+	ring   *Ring
+	groups map[string]*Group
+}
+
+// A Group is a named cache, spread across all peers in a pool.
+type Group struct {
+	name   string
+	pool   *Pool
+	getter Getter
+	main   *cache.LRU[string, []byte]
+	hot    *cache.LRW[string, []byte]
+}
+
+// Create a pool for the local replica, which is reachable by other
+// peers on the base URL self (e.g., "http://10.0.0.1:8080").
+func NewPool(self string) *Pool {
+	p := &Pool{
+		self:   strings.TrimSuffix(self, "/"),
+		client: http.DefaultClient,
+		groups: make(map[string]*Group),
+	}
+	p.SetPeers(self)
+
+	return p
+}
+
+// Set the HTTP client used to talk to other peers.
+func (p *Pool) SetClient(c *http.Client) *Pool {
+	p.client = c
+
+	return p
+}
+
+// Set the base URLs of all peers, including the local replica. This
+// replaces any previously set peers.
+func (p *Pool) SetPeers(peers ...string) *Pool {
+	ring := NewRing(DefaultReplicas)
+	for _, peer := range peers {
+		ring.Add(strings.TrimSuffix(peer, "/"))
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.ring = ring
+
+	return p
+}
+
+func (p *Pool) owner(key string) string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.ring.Owner(key)
+}
+
+// Create a new group in the pool. Keys owned by the local replica are
+// kept in a cache of size cacheSize, keys owned by other peers in one
+// of size hotSize, for at most DefaultHotAge after they were fetched.
+func (p *Pool) NewGroup(name string, cacheSize, hotSize int, getter Getter) (*Group, error) {
+	main, err := cache.NewLRUCache("", []byte{}, cacheSize, 0)
+	if err != nil {
+		return nil, err
+	}
+	hot, err := cache.NewLRWCache("", []byte{}, hotSize, DefaultHotAge)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Group{name: name, pool: p, getter: getter, main: main, hot: hot}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.groups[name] = g
+
+	return g, nil
+}
+
+func (p *Pool) group(name string) *Group {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.groups[name]
+}
+
+// Serve values for keys owned by this replica to other peers.
+func (p *Pool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.EscapedPath(), DefaultBasePath)
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	name, err1 := url.PathUnescape(parts[0])
+	key, err2 := url.PathUnescape(parts[1])
+	if err1 != nil || err2 != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	g := p.group(name)
+	if g == nil {
+		http.Error(w, UnknownGroup.Error(), http.StatusNotFound)
+		return
+	}
+
+	value, err := g.load(r.Context(), key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(value)
+}
+
+// Load a key owned by the local replica.
+func (g *Group) load(ctx context.Context, key string) ([]byte, error) {
+	return cache.GetOrLoadLRUContext(ctx, g.main, key, cache.ContextLoader[string, []byte](g.getter))
+}
+
+// Fetch a key from the peer owning it.
+func (g *Group) fetch(ctx context.Context, peer, key string) ([]byte, error) {
+	u := peer + DefaultBasePath + url.PathEscape(g.name) + "/" + url.PathEscape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := g.pool.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %q from %s: %s: %s", key, peer, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
+
+// Get the value for a key. If the local replica owns the key, it is
+// loaded locally, otherwise it is fetched from the owning peer and
+// kept in the hot cache. If the owning peer can not be reached, the
+// value is loaded locally instead.
+func (g *Group) Get(ctx context.Context, key string) ([]byte, error) {
+	if v, ok := cache.GetLRU(g.main, key); ok {
+		return v, nil
+	}
+
+	owner := g.pool.owner(key)
+	if owner == g.pool.self || owner == "" {
+		return g.load(ctx, key)
+	}
+
+	return cache.GetOrLoadLRWContext(ctx, g.hot, key, func(ctx context.Context, k string) ([]byte, error) {
+		v, err := g.fetch(ctx, owner, k)
+		if err != nil {
+			return g.getter(ctx, k)
+		}
+		return v, nil
+	})
+}
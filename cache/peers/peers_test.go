@@ -0,0 +1,204 @@
+package peers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vatine/goutils/cache"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(10)
+	if r.Owner("a") != "" {
+		t.Errorf("Empty ring has an owner")
+	}
+
+	r.Add("n1", "n2", "n3")
+	counts := make(map[string]int)
+	owners := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		k := fmt.Sprint(i)
+		owners[k] = r.Owner(k)
+		counts[owners[k]]++
+	}
+	for _, n := range []string{"n1", "n2", "n3"} {
+		if counts[n] == 0 {
+			t.Errorf("Node %s owns no keys", n)
+		}
+	}
+
+	r.Add("n4")
+	for k, before := range owners {
+		if after := r.Owner(k); after != before && after != "n4" {
+			t.Errorf("Key %s moved from %s to %s", k, before, after)
+		}
+	}
+}
+
+// A cluster of in-process replicas, each counting its loader calls.
+type cluster struct {
+	servers []*httptest.Server
+	pools   []*Pool
+	groups  []*Group
+	lock    sync.Mutex
+	loads   map[string][]string
+}
+
+func newCluster(t *testing.T, n int) *cluster {
+	c := &cluster{loads: make(map[string][]string)}
+	var urls []string
+
+	for i := 0; i < n; i++ {
+		ix := i
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.pools[ix].ServeHTTP(w, r)
+		}))
+		c.servers = append(c.servers, s)
+		urls = append(urls, s.URL)
+	}
+
+	for _, u := range urls {
+		self := u
+		p := NewPool(self).SetPeers(urls...)
+		g, err := p.NewGroup("test", 100, 10, func(ctx context.Context, key string) ([]byte, error) {
+			c.lock.Lock()
+			c.loads[key] = append(c.loads[key], self)
+			c.lock.Unlock()
+			if key == "bad" {
+				return nil, errors.New("no such key")
+			}
+			return []byte("value:" + key), nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		c.pools = append(c.pools, p)
+		c.groups = append(c.groups, g)
+	}
+
+	return c
+}
+
+func (c *cluster) close() {
+	for _, s := range c.servers {
+		s.Close()
+	}
+}
+
+func TestGroupGet(t *testing.T) {
+	c := newCluster(t, 3)
+	defer c.close()
+
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		for round := 0; round < 2; round++ {
+			for ix, g := range c.groups {
+				v, err := g.Get(ctx, key)
+				if err != nil {
+					t.Fatalf("Replica %d, key %s, unexpected error %v", ix, key, err)
+				}
+				if string(v) != "value:"+key {
+					t.Errorf("Replica %d, key %s, unexpected value %s", ix, key, v)
+				}
+			}
+		}
+
+		loads := c.loads[key]
+		if len(loads) != 1 {
+			t.Errorf("Key %s, want 1 load, saw %v", key, loads)
+			continue
+		}
+		if owner := c.pools[0].owner(key); loads[0] != owner {
+			t.Errorf("Key %s loaded on %s, owner is %s", key, loads[0], owner)
+		}
+	}
+}
+
+func TestGroupGetError(t *testing.T) {
+	c := newCluster(t, 2)
+	defer c.close()
+
+	for ix, g := range c.groups {
+		if _, err := g.Get(context.Background(), "bad"); err == nil {
+			t.Errorf("Replica %d, expected an error", ix)
+		}
+	}
+}
+
+func TestGroupPeerDown(t *testing.T) {
+	c := newCluster(t, 2)
+	defer c.close()
+
+	var key string
+	for i := 0; ; i++ {
+		key = fmt.Sprint(i)
+		if c.pools[0].owner(key) == c.servers[1].URL {
+			break
+		}
+	}
+	c.servers[1].Close()
+
+	v, err := c.groups[0].Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(v) != "value:"+key {
+		t.Errorf("Unexpected value %s", v)
+	}
+}
+
+func TestUnknownGroup(t *testing.T) {
+	p := NewPool("http://localhost")
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DefaultBasePath+"nope/key", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Want 404 for unknown group, saw %d", rec.Code)
+	}
+}
+
+func TestHotExpiry(t *testing.T) {
+	c := newCluster(t, 2)
+	defer c.close()
+
+	var key string
+	for i := 0; ; i++ {
+		key = fmt.Sprint(i)
+		if c.pools[0].owner(key) == c.servers[1].URL {
+			break
+		}
+	}
+
+	now := time.Unix(1000, 0)
+	cache.SetClockLRW(c.groups[0].hot, func() time.Time { return now })
+	ctx := context.Background()
+
+	if v, _ := c.groups[0].Get(ctx, key); string(v) != "value:"+key {
+		t.Fatalf("Unexpected value %s", v)
+	}
+	cache.SetLRU(c.groups[1].main, key, []byte("changed"))
+
+	// Reading the hot copy often does not keep it alive past
+	// DefaultHotAge.
+	for i := 0; i < 5; i++ {
+		now = now.Add(DefaultHotAge / 4)
+		v, err := c.groups[0].Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		want := "value:" + key
+		if i >= 3 {
+			want = "changed"
+		}
+		if string(v) != want {
+			t.Errorf("After %v, want %s, saw %s", now.Sub(time.Unix(1000, 0)), want, v)
+		}
+	}
+}
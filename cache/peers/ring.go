@@ -0,0 +1,59 @@
+package peers
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// The default number of points each node gets on a hash ring.
+const DefaultReplicas = 50
+
+// A consistent hash ring, mapping keys to nodes such that adding or
+// removing a node only moves the keys owned by that node.
+type Ring struct {
+	replicas int
+	hashes   []uint32
+	nodes    map[uint32]string
+}
+
+// Create an empty ring, where each node is placed at the given number
+// of points. A non-positive number of replicas means DefaultReplicas.
+func NewRing(replicas int) *Ring {
+	if replicas < 1 {
+		replicas = DefaultReplicas
+	}
+
+	return &Ring{replicas: replicas, nodes: make(map[uint32]string)}
+}
+
+// Add nodes to the ring.
+func (r *Ring) Add(nodes ...string) {
+	for _, node := range nodes {
+		for i := 0; i < r.replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + node))
+			if _, ok := r.nodes[h]; ok {
+				continue
+			}
+			r.hashes = append(r.hashes, h)
+			r.nodes[h] = node
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// Return the node owning a key, or the empty string if the ring has
+// no nodes.
+func (r *Ring) Owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+
+	h := crc32.ChecksumIEEE([]byte(key))
+	ix := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if ix == len(r.hashes) {
+		ix = 0
+	}
+
+	return r.nodes[r.hashes[ix]]
+}
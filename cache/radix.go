@@ -0,0 +1,146 @@
+package cache
+
+// A radix tree of strings, used as a prefix index for string-keyed
+// caches.
+
+import (
+	"strings"
+)
+
+// Kept up to date with the keys of a cache, once set up.
+type keyIndex[K comparable] interface {
+	insert(k K)
+	remove(k K)
+}
+
+type radixNode struct {
+	prefix   string
+	leaf     bool
+	children map[byte]*radixNode
+}
+
+type radixTree struct {
+	root radixNode
+}
+
+func newRadixTree() *radixTree {
+	return &radixTree{}
+}
+
+func commonPrefixLen(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+
+	return n
+}
+
+func addChild(n, child *radixNode) {
+	if n.children == nil {
+		n.children = make(map[byte]*radixNode)
+	}
+	n.children[child.prefix[0]] = child
+}
+
+func (t *radixTree) insert(key string) {
+	n := &t.root
+
+	for {
+		if key == "" {
+			n.leaf = true
+			return
+		}
+
+		c := n.children[key[0]]
+		if c == nil {
+			addChild(n, &radixNode{prefix: key, leaf: true})
+			return
+		}
+
+		l := commonPrefixLen(key, c.prefix)
+		if l < len(c.prefix) {
+			// Split the edge to c, at the point where key diverges.
+			mid := &radixNode{prefix: c.prefix[:l]}
+			c.prefix = c.prefix[l:]
+			addChild(mid, c)
+			addChild(n, mid)
+			c = mid
+		}
+		n = c
+		key = key[l:]
+	}
+}
+
+// Remove key from the subtree rooted at n, pruning and merging nodes
+// that are no longer needed. Returns true if the key was found.
+func radixRemove(n *radixNode, key string) bool {
+	if key == "" {
+		if !n.leaf {
+			return false
+		}
+		n.leaf = false
+		return true
+	}
+
+	c := n.children[key[0]]
+	if c == nil || !strings.HasPrefix(key, c.prefix) {
+		return false
+	}
+	if !radixRemove(c, key[len(c.prefix):]) {
+		return false
+	}
+
+	if !c.leaf {
+		switch len(c.children) {
+		case 0:
+			delete(n.children, key[0])
+		case 1:
+			for _, grandchild := range c.children {
+				grandchild.prefix = c.prefix + grandchild.prefix
+				n.children[key[0]] = grandchild
+			}
+		}
+	}
+
+	return true
+}
+
+func (t *radixTree) remove(key string) {
+	radixRemove(&t.root, key)
+}
+
+func radixCollect(n *radixNode, acc string, out []string) []string {
+	if n.leaf {
+		out = append(out, acc)
+	}
+	for _, c := range n.children {
+		out = radixCollect(c, acc+c.prefix, out)
+	}
+
+	return out
+}
+
+// Return all keys in the tree starting with prefix.
+func (t *radixTree) withPrefix(prefix string) []string {
+	n := &t.root
+	acc := ""
+
+	for prefix != "" {
+		c := n.children[prefix[0]]
+		switch {
+		case c == nil:
+			return nil
+		case strings.HasPrefix(prefix, c.prefix):
+			acc += c.prefix
+			prefix = prefix[len(c.prefix):]
+			n = c
+		case strings.HasPrefix(c.prefix, prefix):
+			return radixCollect(c, acc+c.prefix, nil)
+		default:
+			return nil
+		}
+	}
+
+	return radixCollect(n, acc, nil)
+}
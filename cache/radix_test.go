@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"sort"
+	"testing"
+)
+
+func checkPrefix(ix int, tree *radixTree, prefix string, want []string, t *testing.T) {
+	got := tree.withPrefix(prefix)
+	sort.Strings(got)
+	sort.Strings(want)
+
+	if len(got) != len(want) {
+		t.Errorf("Case #%d, prefix %q, want %v, saw %v", ix, prefix, want, got)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("Case #%d, prefix %q, want %v, saw %v", ix, prefix, want, got)
+			return
+		}
+	}
+}
+
+func TestRadixTree(t *testing.T) {
+	tree := newRadixTree()
+	for _, k := range []string{"user:1:a", "user:1:b", "user:12:a", "user:2", "users", "u", ""} {
+		tree.insert(k)
+	}
+
+	cases := []struct {
+		prefix string
+		want   []string
+	}{
+		{"user:1:", []string{"user:1:a", "user:1:b"}},
+		{"user:1", []string{"user:1:a", "user:1:b", "user:12:a"}},
+		{"user", []string{"user:1:a", "user:1:b", "user:12:a", "user:2", "users"}},
+		{"us", []string{"user:1:a", "user:1:b", "user:12:a", "user:2", "users"}},
+		{"user:3", []string{}},
+		{"x", []string{}},
+		{"", []string{"user:1:a", "user:1:b", "user:12:a", "user:2", "users", "u", ""}},
+	}
+	for ix, tc := range cases {
+		checkPrefix(ix, tree, tc.prefix, tc.want, t)
+	}
+
+	tree.remove("user:1:a")
+	tree.remove("user:2")
+	tree.remove("nope")
+	tree.remove("")
+	checkPrefix(7, tree, "u", []string{"user:1:b", "user:12:a", "users", "u"}, t)
+
+	tree.remove("user:1:b")
+	tree.remove("user:12:a")
+	tree.remove("users")
+	tree.remove("u")
+	checkPrefix(8, tree, "", []string{}, t)
+	if len(tree.root.children) != 0 {
+		t.Errorf("Tree not pruned, root has %d children", len(tree.root.children))
+	}
+}
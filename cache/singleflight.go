@@ -0,0 +1,163 @@
+package cache
+
+// Ensure that concurrent loads of the same key only call the loader
+// once, with all callers sharing the result.
+//
+// The load runs in its own goroutine, so a caller whose context is
+// done can stop waiting without disturbing the other callers. The
+// load is only cancelled once every caller waiting for it has gone.
+// If the loader panics, the panic is raised again in every caller
+// waiting for it.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+type flight[V any] struct {
+	done    chan struct{}
+	value   V
+	err     error
+	panic   *loaderPanic
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Returned to callers waiting for a loader that called
+// runtime.Goexit, rather than returning.
+var loaderExited = errors.New("cache loader exited without returning")
+
+// A panic from a loader, carrying the stack of the goroutine it
+// happened in, to be raised again in the waiting callers.
+type loaderPanic struct {
+	value any
+	stack []byte
+}
+
+func (p *loaderPanic) Error() string {
+	return fmt.Sprintf("cache loader panicked: %v\n\n%s", p.value, p.stack)
+}
+
+func (p *loaderPanic) Unwrap() error {
+	err, _ := p.value.(error)
+	return err
+}
+
+// Call a loader, turning a panic into a value.
+func runLoad[V any](ctx context.Context, f func(context.Context) (V, error)) (v V, err error, p *loaderPanic) {
+	defer func() {
+		if r := recover(); r != nil {
+			p = &loaderPanic{value: r, stack: debug.Stack()}
+		}
+	}()
+
+	v, err = f(ctx)
+	return v, err, nil
+}
+
+type flightGroup[K comparable, V any] struct {
+	lock    sync.Mutex
+	flights map[K]*flight[V]
+}
+
+// A context carrying the values of its parent, but never done.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (d detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (d detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (d detachedContext) Err() error {
+	return nil
+}
+
+func (d detachedContext) Value(key any) any {
+	return d.parent.Value(key)
+}
+
+// Build the context for a shared load. It carries the values of the
+// context of the caller starting the load, but neither its deadline
+// nor its cancellation, as other callers may wait longer for the
+// result. It is only cancelled once every caller has given up.
+func loadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithCancel(detachedContext{ctx})
+}
+
+// Forget a flight, unless it has already been replaced by a newer
+// one. Must be called with the lock held.
+func dropFlight[K comparable, V any](g *flightGroup[K, V], k K, fl *flight[V]) {
+	if g.flights[k] == fl {
+		delete(g.flights, k)
+	}
+}
+
+// Call f for key k, unless a call for k is already in progress, in
+// which case wait for that call and return its result. If ctx is done
+// before the result is ready, return ctx.Err().
+func doFlightContext[K comparable, V any](ctx context.Context, g *flightGroup[K, V], k K, f func(context.Context) (V, error)) (V, error) {
+	g.lock.Lock()
+	if g.flights == nil {
+		g.flights = make(map[K]*flight[V])
+	}
+	fl, ok := g.flights[k]
+	if !ok {
+		loadCtx, cancel := loadContext(ctx)
+		fl = &flight[V]{done: make(chan struct{}), cancel: cancel}
+		g.flights[k] = fl
+
+		go func() {
+			var v V
+			err := loaderExited
+			var p *loaderPanic
+			defer func() {
+				cancel()
+				g.lock.Lock()
+				fl.value, fl.err, fl.panic = v, err, p
+				dropFlight(g, k, fl)
+				g.lock.Unlock()
+				close(fl.done)
+			}()
+
+			v, err, p = runLoad(loadCtx, f)
+		}()
+	}
+	fl.waiters++
+	g.lock.Unlock()
+
+	select {
+	case <-fl.done:
+		if fl.panic != nil {
+			panic(fl.panic)
+		}
+		return fl.value, fl.err
+	case <-ctx.Done():
+		g.lock.Lock()
+		fl.waiters--
+		if fl.waiters == 0 {
+			fl.cancel()
+			dropFlight(g, k, fl)
+		}
+		g.lock.Unlock()
+
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// Call f for key k, unless a call for k is already in progress, in
+// which case wait for that call and return its result.
+func doFlight[K comparable, V any](g *flightGroup[K, V], k K, f func() (V, error)) (V, error) {
+	return doFlightContext(context.Background(), g, k, func(context.Context) (V, error) {
+		return f()
+	})
+}
@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFlightWaiterCancel(t *testing.T) {
+	var g flightGroup[string, int]
+	release := make(chan struct{})
+	started := make(chan context.Context, 1)
+
+	load := func(ctx context.Context) (int, error) {
+		started <- ctx
+		<-release
+		return 42, ctx.Err()
+	}
+
+	patient := make(chan int)
+	go func() {
+		v, _ := doFlightContext(context.Background(), &g, "k", load)
+		patient <- v
+	}()
+	loadCtx := <-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	impatient := make(chan error)
+	go func() {
+		_, err := doFlightContext(ctx, &g, "k", load)
+		impatient <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-impatient:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Want context.Canceled, saw %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Cancelled waiter did not return")
+	}
+	if loadCtx.Err() != nil {
+		t.Errorf("Shared load cancelled with other waiters left")
+	}
+
+	close(release)
+	if v := <-patient; v != 42 {
+		t.Errorf("Want 42, saw %d", v)
+	}
+}
+
+func TestFlightAllWaitersGone(t *testing.T) {
+	var g flightGroup[string, int]
+	started := make(chan context.Context, 1)
+	finished := make(chan struct{})
+
+	load := func(ctx context.Context) (int, error) {
+		started <- ctx
+		<-ctx.Done()
+		close(finished)
+		return 0, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := doFlightContext(ctx, &g, "k", load)
+		done <- err
+	}()
+	<-started
+	cancel()
+	<-done
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatalf("Load not cancelled once all waiters were gone")
+	}
+
+	// A new caller must start a fresh load, not join the cancelled one.
+	v, err := doFlightContext(context.Background(), &g, "k", func(context.Context) (int, error) {
+		return 7, nil
+	})
+	if v != 7 || err != nil {
+		t.Errorf("Want 7/nil, saw %d/%v", v, err)
+	}
+}
+
+func TestFlightContextDeadline(t *testing.T) {
+	var g flightGroup[string, string]
+	type ctxKey struct{}
+	started := make(chan struct{})
+
+	short := context.WithValue(context.Background(), ctxKey{}, "value")
+	short, cancel := context.WithTimeout(short, 20*time.Millisecond)
+	defer cancel()
+
+	load := func(ctx context.Context) (string, error) {
+		close(started)
+		if _, ok := ctx.Deadline(); ok {
+			return "", errors.New("first caller's deadline propagated")
+		}
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		return ctx.Value(ctxKey{}).(string), nil
+	}
+
+	shortErr := make(chan error, 1)
+	go func() {
+		_, err := doFlightContext(short, &g, "k", load)
+		shortErr <- err
+	}()
+	<-started
+
+	v, err := doFlightContext(context.Background(), &g, "k", load)
+	if v != "value" || err != nil {
+		t.Errorf("Want «value»/nil, saw «%s»/%v", v, err)
+	}
+	if err := <-shortErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Want deadline exceeded for the short caller, saw %v", err)
+	}
+}
+
+func TestFlightSharing(t *testing.T) {
+	var g flightGroup[int, int]
+	var lock sync.Mutex
+	calls := 0
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			doFlight(&g, 1, func() (int, error) {
+				lock.Lock()
+				calls++
+				lock.Unlock()
+				<-release
+				return 1, nil
+			})
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Want 1 call, saw %d", calls)
+	}
+}
+
+func TestFlightPanic(t *testing.T) {
+	lru, _ := NewLRUCache("", 0, 10, 0)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var once sync.Once
+
+	recovered := make(chan any, 2)
+	load := func() {
+		defer func() {
+			recovered <- recover()
+		}()
+		GetOrLoadLRU(lru, "k", func(string) (int, error) {
+			once.Do(func() { close(started) })
+			<-release
+			panic("boom")
+		})
+	}
+	go load()
+	<-started
+	go load()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		r := <-recovered
+		p, ok := r.(*loaderPanic)
+		if !ok || p.value != "boom" {
+			t.Errorf("Want the loader's panic re-raised, saw %v", r)
+		}
+	}
+
+	// The flight is gone, so the next caller loads again.
+	v, err := GetOrLoadLRU(lru, "k", func(string) (int, error) { return 7, nil })
+	if v != 7 || err != nil {
+		t.Errorf("Want 7, saw %d, %v", v, err)
+	}
+}
+
+func TestFlightGoexit(t *testing.T) {
+	var g flightGroup[string, int]
+	done := make(chan error)
+	go func() {
+		_, err := doFlight(&g, "k", func() (int, error) {
+			runtime.Goexit()
+			return 0, nil
+		})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, loaderExited) {
+			t.Errorf("Want loaderExited, saw %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Caller blocked on an exited loader")
+	}
+}
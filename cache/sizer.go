@@ -0,0 +1,146 @@
+package cache
+
+// Approximate the memory used by values, for memory-bounded caches.
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Rough fixed overhead of a map, on top of its entries.
+const mapOverhead = 48
+
+// Values implementing Sizer report their own approximate size in
+// bytes, instead of having it estimated by reflection.
+type Sizer interface {
+	CacheSize() int
+}
+
+var sizerType = reflect.TypeOf((*Sizer)(nil)).Elem()
+
+// Cache of flatType results, keyed by reflect.Type.
+var flatTypes sync.Map
+
+// Check if values of a type refer to no other memory, and do not
+// implement Sizer, so their size is just the size of the type. This
+// lets slices, arrays and maps of them be sized without looking at
+// every element.
+func flatType(t reflect.Type) bool {
+	if flat, ok := flatTypes.Load(t); ok {
+		return flat.(bool)
+	}
+
+	flat := false
+	if !t.Implements(sizerType) {
+		switch t.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+			flat = true
+		case reflect.Array:
+			flat = flatType(t.Elem())
+		case reflect.Struct:
+			flat = true
+			for i := 0; i < t.NumField() && flat; i++ {
+				flat = flatType(t.Field(i).Type)
+			}
+		}
+	}
+	flatTypes.Store(t, flat)
+
+	return flat
+}
+
+// Estimate the number of bytes used by a value, including memory it
+// refers to through pointers, slices, strings and maps. Values
+// implementing Sizer are asked for their size instead. Memory
+// reachable through more than one pointer is only counted once.
+func EstimateSize(v any) int {
+	if s, ok := v.(Sizer); ok {
+		return s.CacheSize()
+	}
+	if v == nil {
+		return 0
+	}
+
+	rv := reflect.ValueOf(v)
+	return int(rv.Type().Size()) + indirectSize(rv, make(map[uintptr]bool))
+}
+
+// Estimate the memory a value refers to, beyond its own size.
+func indirectSize(v reflect.Value, seen map[uintptr]bool) int {
+	if v.Kind() == reflect.String && !v.Type().Implements(sizerType) {
+		return v.Len()
+	}
+	if flatType(v.Type()) {
+		return 0
+	}
+	if v.CanInterface() && v.Kind() != reflect.Interface {
+		if s, ok := v.Interface().(Sizer); ok {
+			if n := s.CacheSize() - int(v.Type().Size()); n > 0 {
+				return n
+			}
+			return 0
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.Len()
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		elem := v.Elem()
+		return int(elem.Type().Size()) + indirectSize(elem, seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		elem := v.Elem()
+		return int(elem.Type().Size()) + indirectSize(elem, seen)
+	case reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		rv := v.Cap() * int(v.Type().Elem().Size())
+		if flatType(v.Type().Elem()) {
+			return rv
+		}
+		for i := 0; i < v.Len(); i++ {
+			rv += indirectSize(v.Index(i), seen)
+		}
+		return rv
+	case reflect.Array:
+		rv := 0
+		for i := 0; i < v.Len(); i++ {
+			rv += indirectSize(v.Index(i), seen)
+		}
+		return rv
+	case reflect.Struct:
+		rv := 0
+		for i := 0; i < v.NumField(); i++ {
+			rv += indirectSize(v.Field(i), seen)
+		}
+		return rv
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		entry := int(v.Type().Key().Size() + v.Type().Elem().Size())
+		rv := mapOverhead
+		if flatType(v.Type().Key()) && flatType(v.Type().Elem()) {
+			return rv + v.Len()*entry
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			rv += entry + indirectSize(iter.Key(), seen) + indirectSize(iter.Value(), seen)
+		}
+		return rv
+	}
+
+	return 0
+}
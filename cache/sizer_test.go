@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+type fixedSize struct {
+	payload []byte
+}
+
+func (f fixedSize) CacheSize() int {
+	return 1000
+}
+
+type vec struct {
+	x, y float64
+}
+
+type record struct {
+	name string
+	data []byte
+	tags map[string]string
+	next *record
+}
+
+func TestEstimateSize(t *testing.T) {
+	shared := &record{name: "shared"}
+	withCycle := &record{name: "loop"}
+	withCycle.next = withCycle
+
+	recordSize := EstimateSize(record{})
+	cases := []struct {
+		v    any
+		want int
+	}{
+		{nil, 0},
+		{int64(3), 8},
+		{"hello", 16 + 5},
+		{[]byte("hello"), 24 + 5},
+		{fixedSize{}, 1000},
+		{[]fixedSize{{}, {}}, 24 + 2000},
+		{record{name: "ab", data: make([]byte, 10)}, recordSize + 2 + 10},
+		{[]*record{shared, shared}, 24 + 16 + recordSize + 6},
+		{withCycle, 8 + recordSize + 4},
+		{make([]vec, 3, 10), 24 + 160},
+		{[4]vec{}, 64},
+		{map[int]vec{1: {}, 2: {}}, 8 + mapOverhead + 2*24},
+		{[]fixedSize{{}}, 24 + 1000},
+	}
+
+	for ix, tc := range cases {
+		if got := EstimateSize(tc.v); got != tc.want {
+			t.Errorf("Case #%d, want %d, saw %d", ix, tc.want, got)
+		}
+	}
+
+	small := EstimateSize(map[string]string{"a": "b"})
+	large := EstimateSize(map[string]string{"a": "b", "c": "dddd"})
+	if large <= small {
+		t.Errorf("Larger map estimated smaller, %d <= %d", large, small)
+	}
+}
+
+func TestEstimateSizeLarge(t *testing.T) {
+	data := make([]byte, 1<<20)
+	before := time.Now()
+	for i := 0; i < 100; i++ {
+		if got := EstimateSize(data); got != 24+1<<20 {
+			t.Fatalf("Want %d, saw %d", 24+1<<20, got)
+		}
+	}
+	// Sizing a flat slice should not look at every element.
+	if elapsed := time.Since(before); elapsed > 100*time.Millisecond {
+		t.Errorf("Sizing 100 1MiB slices took %v", elapsed)
+	}
+}
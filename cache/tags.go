@@ -0,0 +1,56 @@
+package cache
+
+// Tag index for caches, allowing all entries sharing a tag to be
+// found without scanning the whole cache.
+
+type tagIndex[K comparable] struct {
+	byTag map[string]map[K]struct{}
+	byKey map[K][]string
+}
+
+// Remove all tags from a key.
+func untagKey[K comparable](ti *tagIndex[K], k K) {
+	for _, tag := range ti.byKey[k] {
+		keys := ti.byTag[tag]
+		delete(keys, k)
+		if len(keys) == 0 {
+			delete(ti.byTag, tag)
+		}
+	}
+	delete(ti.byKey, k)
+}
+
+// Set the tags for a key, replacing any tags it had before.
+func tagKey[K comparable](ti *tagIndex[K], k K, tags []string) {
+	untagKey(ti, k)
+	if len(tags) == 0 {
+		return
+	}
+
+	if ti.byTag == nil {
+		ti.byTag = make(map[string]map[K]struct{})
+		ti.byKey = make(map[K][]string)
+	}
+	for _, tag := range tags {
+		keys, ok := ti.byTag[tag]
+		if !ok {
+			keys = make(map[K]struct{})
+			ti.byTag[tag] = keys
+		}
+		if _, dup := keys[k]; dup {
+			continue
+		}
+		keys[k] = struct{}{}
+		ti.byKey[k] = append(ti.byKey[k], tag)
+	}
+}
+
+// Return all keys carrying a tag.
+func taggedKeys[K comparable](ti *tagIndex[K], tag string) []K {
+	rv := make([]K, 0, len(ti.byTag[tag]))
+	for k := range ti.byTag[tag] {
+		rv = append(rv, k)
+	}
+
+	return rv
+}
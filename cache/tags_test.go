@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestTagIndex(t *testing.T) {
+	var ti tagIndex[int]
+
+	tagKey(&ti, 1, []string{"a", "b"})
+	tagKey(&ti, 2, []string{"a", "a"})
+	tagKey(&ti, 3, nil)
+
+	cases := []struct {
+		tag  string
+		want []int
+	}{
+		{"a", []int{1, 2}},
+		{"b", []int{1}},
+		{"c", []int{}},
+	}
+	for ix, tc := range cases {
+		got := taggedKeys(&ti, tc.tag)
+		sort.Ints(got)
+		if len(got) != len(tc.want) {
+			t.Errorf("Case #%d, want %v, saw %v", ix, tc.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("Case #%d, want %v, saw %v", ix, tc.want, got)
+			}
+		}
+	}
+
+	tagKey(&ti, 1, []string{"c"})
+	if _, ok := ti.byTag["b"]; ok {
+		t.Errorf("Empty tag b still in index")
+	}
+	untagKey(&ti, 1)
+	untagKey(&ti, 2)
+	if len(ti.byTag) != 0 || len(ti.byKey) != 0 {
+		t.Errorf("Index not empty, %v %v", ti.byTag, ti.byKey)
+	}
+}
@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+type ttlEntry[K comparable, V any] struct {
+	key      K
+	value    V
+	deadline time.Time
+	index    int
+	timer    *WheelTimer[K]
+}
+
+// A min-heap of entries, ordered by deadline.
+type ttlHeap[K comparable, V any] []*ttlEntry[K, V]
+
+func (h ttlHeap[K, V]) Len() int {
+	return len(h)
+}
+
+func (h ttlHeap[K, V]) Less(i, j int) bool {
+	return h[i].deadline.Before(h[j].deadline)
+}
+
+func (h ttlHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *ttlHeap[K, V]) Push(x any) {
+	e := x.(*ttlEntry[K, V])
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *ttlHeap[K, V]) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+
+	return e
+}
+
+// Implements a map where every entry expires a set time after it was
+// written, with no bound on the number of entries. Expired entries
+// are removed on every access to the map, at O(log n) cost each, or
+// O(1) for maps using a timing wheel.
+type TTLMap[K comparable, V any] struct {
+	lock      sync.Mutex
+	m         map[K]*ttlEntry[K, V]
+	deadline  ttlHeap[K, V]
+	ttl       time.Duration
+	clock     Clock
+	wheelTick time.Duration
+	wheel     *TimingWheel[K]
+}
+
+// Return a new TTL map, where entries expire ttl after being set
+// unless given their own time to live.
+//
+// The provided key (k) and value (v) are ONLY used for their type(s).
+//
+// If ttl is not positive, an error is returned.
+func NewTTLMap[K comparable, V any](k K, v V, ttl time.Duration) (*TTLMap[K, V], error) {
+	if ttl <= 0 {
+		return nil, IncorrectlySpecified
+	}
+	rv := new(TTLMap[K, V])
+	rv.m = make(map[K]*ttlEntry[K, V])
+	rv.ttl = ttl
+
+	return rv, nil
+}
+
+// Return a new TTL map that keeps track of deadlines in a timing
+// wheel with the given tick length, rather than a heap. This is
+// cheaper for very large numbers of entries, at the cost of expired
+// entries lingering for up to a tick (although they are never
+// returned).
+//
+// If ttl or tick is not positive, an error is returned.
+func NewWheelTTLMap[K comparable, V any](k K, v V, ttl, tick time.Duration) (*TTLMap[K, V], error) {
+	if tick <= 0 {
+		return nil, IncorrectlySpecified
+	}
+	rv, err := NewTTLMap(k, v, ttl)
+	if err != nil {
+		return nil, err
+	}
+	rv.wheelTick = tick
+
+	return rv, nil
+}
+
+// Remove all entries whose deadline has passed.
+func ttlExpire[K comparable, V any](m *TTLMap[K, V], now time.Time) {
+	if m.wheelTick > 0 {
+		if m.wheel == nil {
+			m.wheel, _ = NewTimingWheel[K](now, m.wheelTick, 256, 4)
+		}
+		for _, k := range AdvanceWheel(m.wheel, now) {
+			delete(m.m, k)
+		}
+		return
+	}
+
+	for len(m.deadline) > 0 && !now.Before(m.deadline[0].deadline) {
+		e := heap.Pop(&m.deadline).(*ttlEntry[K, V])
+		delete(m.m, e.key)
+	}
+}
+
+func ttlSet[K comparable, V any](m *TTLMap[K, V], k K, v V, ttl time.Duration, now time.Time) {
+	ttlExpire(m, now)
+
+	if e, ok := m.m[k]; ok {
+		e.value = v
+		e.deadline = now.Add(ttl)
+		if m.wheel != nil {
+			RescheduleWheel(m.wheel, e.timer, e.deadline)
+		} else {
+			heap.Fix(&m.deadline, e.index)
+		}
+		return
+	}
+
+	e := &ttlEntry[K, V]{key: k, value: v, deadline: now.Add(ttl)}
+	m.m[k] = e
+	if m.wheel != nil {
+		e.timer = ScheduleWheel(m.wheel, k, e.deadline)
+	} else {
+		heap.Push(&m.deadline, e)
+	}
+}
+
+// Remove a single entry, before its deadline.
+func ttlRemove[K comparable, V any](m *TTLMap[K, V], e *ttlEntry[K, V]) {
+	if m.wheel != nil {
+		CancelWheel(m.wheel, e.timer)
+	} else {
+		heap.Remove(&m.deadline, e.index)
+	}
+	delete(m.m, e.key)
+}
+
+func ttlGet[K comparable, V any](m *TTLMap[K, V], k K, now time.Time) (V, bool) {
+	ttlExpire(m, now)
+
+	var zero V
+	e, ok := m.m[k]
+	if !ok {
+		return zero, false
+	}
+	if !now.Before(e.deadline) {
+		// Only possible for a timing wheel, which has not yet
+		// reached the entry's tick.
+		ttlRemove(m, e)
+		return zero, false
+	}
+
+	return e.value, true
+}
+
+// Set a value in a TTL map, expiring after the map's default time to
+// live. Safe for concurrent use.
+func SetTTLMap[K comparable, V any](m *TTLMap[K, V], k K, v V) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ttlSet(m, k, v, m.ttl, clockNow(m.clock))
+}
+
+// Set a value in a TTL map, expiring after ttl.
+func SetTTLMapFor[K comparable, V any](m *TTLMap[K, V], k K, v V, ttl time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ttlSet(m, k, v, ttl, clockNow(m.clock))
+}
+
+// Get a value from a TTL map. The returned bool is true if the key
+// existed and had not expired, otherwise false.
+func GetTTLMap[K comparable, V any](m *TTLMap[K, V], k K) (V, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return ttlGet(m, k, clockNow(m.clock))
+}
+
+// Delete a key from a TTL map. The returned bool is true if the key
+// existed and had not expired, otherwise false.
+func DeleteTTLMap[K comparable, V any](m *TTLMap[K, V], k K) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := clockNow(m.clock)
+	ttlExpire(m, now)
+	e, ok := m.m[k]
+	if !ok {
+		return false
+	}
+	ttlRemove(m, e)
+
+	return now.Before(e.deadline)
+}
+
+// Return the number of unexpired entries in a TTL map. For maps using
+// a timing wheel, this may include entries that expired less than a
+// tick ago.
+func LenTTLMap[K comparable, V any](m *TTLMap[K, V]) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ttlExpire(m, clockNow(m.clock))
+
+	return len(m.m)
+}
+
+// Set the clock used by a TTL map. A nil clock means time.Now.
+func SetClockTTLMap[K comparable, V any](m *TTLMap[K, V], clock Clock) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.clock = clock
+}
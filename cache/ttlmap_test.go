@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTTLMapSpecification(t *testing.T) {
+	if _, err := NewTTLMap(0, 0, 0); err != IncorrectlySpecified {
+		t.Errorf("Zero TTL did not fail, saw %v", err)
+	}
+}
+
+func TestTTLMapExpiry(t *testing.T) {
+	m, _ := NewTTLMap("", 0, 10*time.Second)
+
+	cases := []struct {
+		at  int64
+		op  string
+		k   string
+		v   int
+		ttl time.Duration
+		ok  bool
+		len int
+	}{
+		{0, "set", "a", 1, 0, false, 1},
+		{2, "set", "b", 2, 3 * time.Second, false, 2},
+		{4, "get", "b", 2, 0, true, 2},
+		{5, "get", "b", 0, 0, false, 1},
+		{6, "set", "a", 3, 0, false, 1},
+		{12, "get", "a", 3, 0, true, 1},
+		{14, "set", "c", 4, 0, false, 2},
+		{15, "del", "c", 0, 0, true, 1},
+		{15, "del", "c", 0, 0, false, 1},
+		{16, "get", "a", 0, 0, false, 0},
+	}
+
+	for ix, tc := range cases {
+		now := time.Unix(tc.at, 0)
+		switch tc.op {
+		case "set":
+			ttl := tc.ttl
+			if ttl == 0 {
+				ttl = m.ttl
+			}
+			ttlSet(m, tc.k, tc.v, ttl, now)
+		case "get":
+			v, ok := ttlGet(m, tc.k, now)
+			if v != tc.v || ok != tc.ok {
+				t.Errorf("Case #%d, want %d/%v, saw %d/%v", ix, tc.v, tc.ok, v, ok)
+			}
+		case "del":
+			SetClockTTLMap(m, func() time.Time { return now })
+			if ok := DeleteTTLMap(m, tc.k); ok != tc.ok {
+				t.Errorf("Case #%d, want %v, saw %v", ix, tc.ok, ok)
+			}
+		}
+		if len(m.m) != tc.len || len(m.deadline) != tc.len {
+			t.Errorf("Case #%d, want %d entries, saw %d in map and %d in heap", ix, tc.len, len(m.m), len(m.deadline))
+		}
+	}
+}
+
+func TestTTLMapHeapOrder(t *testing.T) {
+	m, _ := NewTTLMap(0, 0, time.Minute)
+	epoch := time.Unix(0, 0)
+
+	// Insert with deadlines in a scrambled order, then check they
+	// expire one at a time, in deadline order.
+	for _, n := range []int{5, 3, 9, 1, 7, 2, 8, 4, 6} {
+		ttlSet(m, n, n, time.Duration(n)*time.Second, epoch)
+	}
+	for n := 1; n <= 9; n++ {
+		ttlExpire(m, epoch.Add(time.Duration(n)*time.Second))
+		if len(m.m) != 9-n {
+			t.Errorf("At %ds, want %d entries left, saw %d", n, 9-n, len(m.m))
+		}
+		if _, ok := m.m[n]; ok {
+			t.Errorf("At %ds, entry %d not expired", n, n)
+		}
+	}
+}
+
+func TestTTLMapConcurrent(t *testing.T) {
+	m, _ := NewTTLMap("", 0, time.Minute)
+	done := make(chan bool)
+
+	for i := 0; i < 4; i++ {
+		go func(base int) {
+			for j := 0; j < 100; j++ {
+				k := fmt.Sprint(base, j)
+				SetTTLMap(m, k, j)
+				GetTTLMap(m, k)
+			}
+			done <- true
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+
+	if n := LenTTLMap(m); n != 400 {
+		t.Errorf("Want 400 entries, saw %d", n)
+	}
+}
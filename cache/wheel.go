@@ -0,0 +1,265 @@
+package cache
+
+// A hierarchical timing wheel, for scheduling large numbers of
+// expiring items. Scheduling and cancelling are O(1); advancing the
+// wheel skips straight over empty ticks, costing O(slots * levels)
+// per tick with work to do, plus the cost of moving items down from
+// coarser levels as their time approaches.
+//
+// Level 0 has one slot per tick, each level above it has slots
+// covering a whole turn of the level below. Items further in the
+// future than the wheel covers are parked in the top level, and
+// re-placed whenever their slot comes around.
+
+import (
+	"sync"
+	"time"
+)
+
+// A scheduled item in a timing wheel.
+type WheelTimer[T any] struct {
+	Item       T
+	expiry     int64
+	slot       *wheelSlot[T]
+	prev, next *WheelTimer[T]
+}
+
+// A slot is a doubly linked list of timers.
+type wheelSlot[T any] struct {
+	head *WheelTimer[T]
+}
+
+// A timing wheel of items of type T. It is safe for concurrent use,
+// but only moves forward when AdvanceWheel is called.
+type TimingWheel[T any] struct {
+	lock    sync.Mutex
+	start   time.Time
+	tick    time.Duration
+	slots   int64
+	spans   []int64
+	wheels  [][]wheelSlot[T]
+	current int64
+	count   int
+}
+
+// Return a new timing wheel, starting at time start, with the given
+// tick length and number of slots per level. The wheel covers
+// slots^levels ticks before it has to park items.
+//
+// If tick is not positive, or there are fewer than 2 slots or fewer
+// than 1 level, an error is returned.
+func NewTimingWheel[T any](start time.Time, tick time.Duration, slots, levels int) (*TimingWheel[T], error) {
+	if tick <= 0 || slots < 2 || levels < 1 {
+		return nil, IncorrectlySpecified
+	}
+
+	rv := &TimingWheel[T]{
+		start: start,
+		tick:  tick,
+		slots: int64(slots),
+	}
+	span := int64(1)
+	for i := 0; i < levels; i++ {
+		rv.spans = append(rv.spans, span)
+		rv.wheels = append(rv.wheels, make([]wheelSlot[T], slots))
+		span *= int64(slots)
+	}
+
+	return rv, nil
+}
+
+func slotAdd[T any](s *wheelSlot[T], t *WheelTimer[T]) {
+	t.slot = s
+	t.prev = nil
+	t.next = s.head
+	if s.head != nil {
+		s.head.prev = t
+	}
+	s.head = t
+}
+
+func slotRemove[T any](t *WheelTimer[T]) {
+	s := t.slot
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		s.head = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	t.slot = nil
+	t.prev = nil
+	t.next = nil
+}
+
+// Put a timer in the right slot, given the current tick.
+func wheelPlace[T any](w *TimingWheel[T], t *WheelTimer[T]) {
+	expiry := t.expiry
+	if expiry <= w.current {
+		expiry = w.current + 1
+	}
+	top := len(w.spans) - 1
+	if limit := w.current + w.spans[top]*w.slots - 1; expiry > limit {
+		expiry = limit
+	}
+
+	level := 0
+	for level < top && expiry-w.current >= w.spans[level+1] {
+		level++
+	}
+	ix := (expiry / w.spans[level]) % w.slots
+	slotAdd(&w.wheels[level][ix], t)
+}
+
+// Convert a deadline to a tick, rounding up so that nothing fires
+// early.
+func wheelTick[T any](w *TimingWheel[T], deadline time.Time) int64 {
+	d := deadline.Sub(w.start)
+	ticks := int64(d / w.tick)
+	if d%w.tick > 0 {
+		ticks++
+	}
+
+	return ticks
+}
+
+// Schedule an item to be returned from AdvanceWheel once deadline has
+// passed. Deadlines already passed are returned by the next call to
+// AdvanceWheel.
+func ScheduleWheel[T any](w *TimingWheel[T], item T, deadline time.Time) *WheelTimer[T] {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	t := &WheelTimer[T]{Item: item, expiry: wheelTick(w, deadline)}
+	wheelPlace(w, t)
+	w.count++
+
+	return t
+}
+
+// Cancel a scheduled timer. The returned bool is true if the timer
+// was still scheduled, otherwise false.
+func CancelWheel[T any](w *TimingWheel[T], t *WheelTimer[T]) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if t.slot == nil {
+		return false
+	}
+	slotRemove(t)
+	w.count--
+
+	return true
+}
+
+// Move a timer to a new deadline, scheduling it again if it has
+// already fired or been cancelled.
+func RescheduleWheel[T any](w *TimingWheel[T], t *WheelTimer[T], deadline time.Time) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if t.slot != nil {
+		slotRemove(t)
+	} else {
+		w.count++
+	}
+	t.expiry = wheelTick(w, deadline)
+	wheelPlace(w, t)
+}
+
+// Move all timers in a slot to wherever they belong now. Timers due
+// on the current tick go in the level 0 slot about to be fired.
+func wheelCascade[T any](w *TimingWheel[T], s *wheelSlot[T]) {
+	t := s.head
+	s.head = nil
+	for t != nil {
+		next := t.next
+		if t.expiry <= w.current {
+			slotAdd(&w.wheels[0][w.current%w.slots], t)
+		} else {
+			wheelPlace(w, t)
+		}
+		t = next
+	}
+}
+
+// Return the next tick with work to do: either a non-empty level 0
+// slot firing, or a non-empty slot at a higher level cascading. This
+// lets AdvanceWheel skip over empty ticks, rather than stepping
+// through them one at a time. Must be called with the lock held, and
+// at least one timer scheduled.
+func wheelNext[T any](w *TimingWheel[T]) int64 {
+	next := int64(-1)
+	for level, span := range w.spans {
+		base := w.current / span
+		for k := int64(1); k <= w.slots; k++ {
+			at := (base + k) * span
+			if next >= 0 && at >= next {
+				break
+			}
+			if w.wheels[level][(base+k)%w.slots].head != nil {
+				next = at
+				break
+			}
+		}
+	}
+
+	return next
+}
+
+// Advance the wheel to now, returning all items whose deadline has
+// passed, in deadline order (to within a tick).
+func AdvanceWheel[T any](w *TimingWheel[T], now time.Time) []T {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	var rv []T
+	target := int64(now.Sub(w.start) / w.tick)
+
+	for w.current < target && w.count > 0 {
+		next := wheelNext(w)
+		if next < 0 || next > target {
+			break
+		}
+		w.current = next
+
+		for level := len(w.spans) - 1; level > 0; level-- {
+			if w.current%w.spans[level] == 0 {
+				ix := (w.current / w.spans[level]) % w.slots
+				wheelCascade(w, &w.wheels[level][ix])
+			}
+		}
+
+		s := &w.wheels[0][w.current%w.slots]
+		t := s.head
+		s.head = nil
+		for t != nil {
+			next := t.next
+			t.slot = nil
+			t.prev = nil
+			t.next = nil
+			if t.expiry <= w.current {
+				rv = append(rv, t.Item)
+				w.count--
+			} else {
+				wheelPlace(w, t)
+			}
+			t = next
+		}
+	}
+	if w.current < target {
+		// Nothing more is due, so skip straight to the target.
+		w.current = target
+	}
+
+	return rv
+}
+
+// Return the number of scheduled timers.
+func LenWheel[T any](w *TimingWheel[T]) int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.count
+}
@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestTimingWheelSpecification(t *testing.T) {
+	epoch := time.Unix(0, 0)
+	cases := []struct {
+		tick          time.Duration
+		slots, levels int
+		ok            bool
+	}{
+		{time.Second, 8, 2, true},
+		{0, 8, 2, false},
+		{time.Second, 1, 2, false},
+		{time.Second, 8, 0, false},
+	}
+
+	for ix, tc := range cases {
+		_, err := NewTimingWheel[int](epoch, tc.tick, tc.slots, tc.levels)
+		if (err == nil) != tc.ok {
+			t.Errorf("Case #%d, unexpected error %v", ix, err)
+		}
+	}
+}
+
+// Schedule items at random deadlines, well beyond what the wheel
+// covers, and check that each item is returned at the first advance
+// after its deadline, rounded up to a whole tick.
+func TestTimingWheelFiring(t *testing.T) {
+	epoch := time.Unix(0, 0)
+	tick := 10 * time.Millisecond
+	w, _ := NewTimingWheel[int](epoch, tick, 4, 3)
+	rng := rand.New(rand.NewSource(1))
+
+	deadlines := make(map[int]time.Time)
+	for i := 0; i < 500; i++ {
+		d := epoch.Add(time.Duration(rng.Int63n(int64(200 * tick))))
+		deadlines[i] = d
+		ScheduleWheel(w, i, d)
+	}
+	if LenWheel(w) != 500 {
+		t.Errorf("Want 500 timers, saw %d", LenWheel(w))
+	}
+
+	prev := epoch
+	for now := epoch; len(deadlines) > 0; now = now.Add(7 * time.Millisecond) {
+		for _, item := range AdvanceWheel(w, now) {
+			d, ok := deadlines[item]
+			if !ok {
+				t.Fatalf("Item %d fired twice", item)
+			}
+			if now.Before(d) {
+				t.Errorf("Item %d fired early, at %v, deadline %v", item, now.Sub(epoch), d.Sub(epoch))
+			}
+			if due := epoch.Add((d.Sub(epoch) + tick - 1) / tick * tick); !prev.Before(due) {
+				t.Errorf("Item %d fired late, at %v, deadline %v", item, now.Sub(epoch), d.Sub(epoch))
+			}
+			delete(deadlines, item)
+		}
+		prev = now
+		if now.After(epoch.Add(300 * tick)) {
+			t.Fatalf("%d items never fired", len(deadlines))
+		}
+	}
+	if LenWheel(w) != 0 {
+		t.Errorf("Want no timers left, saw %d", LenWheel(w))
+	}
+}
+
+func TestTimingWheelCancel(t *testing.T) {
+	epoch := time.Unix(0, 0)
+	w, _ := NewTimingWheel[string](epoch, time.Second, 8, 2)
+
+	a := ScheduleWheel(w, "a", epoch.Add(3*time.Second))
+	b := ScheduleWheel(w, "b", epoch.Add(3*time.Second))
+	c := ScheduleWheel(w, "c", epoch.Add(30*time.Second))
+
+	if !CancelWheel(w, a) || CancelWheel(w, a) {
+		t.Errorf("Unexpected result cancelling a")
+	}
+	RescheduleWheel(w, c, epoch.Add(2*time.Second))
+
+	got := AdvanceWheel(w, epoch.Add(2*time.Second))
+	if len(got) != 1 || got[0] != "c" {
+		t.Errorf("Want [c] at 2s, saw %v", got)
+	}
+	got = AdvanceWheel(w, epoch.Add(time.Minute))
+	if len(got) != 1 || got[0] != "b" {
+		t.Errorf("Want [b] at 1m, saw %v", got)
+	}
+	if CancelWheel(w, b) {
+		t.Errorf("Cancelled a fired timer")
+	}
+
+	// Rescheduling a fired timer schedules it again.
+	RescheduleWheel(w, b, epoch.Add(2*time.Minute))
+	got = AdvanceWheel(w, epoch.Add(2*time.Minute))
+	if len(got) != 1 || got[0] != "b" {
+		t.Errorf("Want [b] at 2m, saw %v", got)
+	}
+}
+
+func TestWheelTTLMap(t *testing.T) {
+	m, _ := NewWheelTTLMap("", 0, 10*time.Second, time.Second)
+	var now time.Time
+	SetClockTTLMap(m, func() time.Time { return now })
+
+	at := func(s float64) {
+		now = time.Unix(0, int64(s*float64(time.Second)))
+	}
+
+	at(0)
+	SetTTLMap(m, "a", 1)
+	SetTTLMapFor(m, "b", 2, 2500*time.Millisecond)
+	at(2.6)
+	if _, ok := GetTTLMap(m, "b"); ok {
+		t.Errorf("Expired entry returned before its tick")
+	}
+	at(5)
+	SetTTLMap(m, "a", 3)
+	at(12)
+	if v, ok := GetTTLMap(m, "a"); !ok || v != 3 {
+		t.Errorf("Want 3, saw %d/%v", v, ok)
+	}
+	at(15)
+	if n := LenTTLMap(m); n != 0 {
+		t.Errorf("Want empty map, saw %d entries", n)
+	}
+	if n := LenWheel(m.wheel); n != 0 {
+		t.Errorf("Want no timers left, saw %d", n)
+	}
+}
+
+func TestTimingWheelSkipsIdleTicks(t *testing.T) {
+	epoch := time.Unix(0, 0)
+	w, _ := NewTimingWheel[string](epoch, time.Millisecond, 256, 4)
+	ScheduleWheel(w, "far", epoch.Add(24*time.Hour))
+	ScheduleWheel(w, "near", epoch.Add(90*time.Second))
+
+	before := time.Now()
+	fired := AdvanceWheel(w, epoch.Add(12*time.Hour))
+	if elapsed := time.Since(before); elapsed > 50*time.Millisecond {
+		t.Errorf("Advancing an idle wheel by 12h took %v", elapsed)
+	}
+	if len(fired) != 1 || fired[0] != "near" {
+		t.Errorf("Want [near], saw %v", fired)
+	}
+
+	if fired := AdvanceWheel(w, epoch.Add(24*time.Hour-time.Millisecond)); len(fired) != 0 {
+		t.Errorf("Fired early, %v", fired)
+	}
+	if fired := AdvanceWheel(w, epoch.Add(24*time.Hour)); len(fired) != 1 || fired[0] != "far" {
+		t.Errorf("Want [far], saw %v", fired)
+	}
+}
@@ -0,0 +1,345 @@
+package circuitbreaker
+
+// A circuit breaker, to stop calling a dependency that keeps failing,
+// giving it time to recover.
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vatine/goutils/backoff"
+)
+
+type State int
+
+const (
+	// Calls go through, and failures are counted.
+	Closed State = iota
+	// Calls fail straight away, until the cool-down has passed.
+	Open
+	// A limited number of probe calls go through. If they all
+	// succeed the breaker closes, if any fails it opens again.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+type BreakerError string
+
+const BreakerOpen BreakerError = "circuit breaker is open"
+
+// Counted as the error of a call that panicked.
+const callPanicked BreakerError = "circuit breaker call panicked"
+
+func (e BreakerError) Error() string {
+	return string(e)
+}
+
+// A Clock returns the current time. Breakers use time.Now unless
+// given another clock.
+type Clock func() time.Time
+
+// Called on every state change, after the change has happened.
+type StateChangeCallback func(from, to State)
+
+// A circuit breaker. All methods, and Call, are safe for concurrent
+// use.
+type Breaker struct {
+	lock  sync.Mutex
+	state State
+	// Bumped on every state change, so that calls let through in
+	// an earlier state do not count in the current one.
+	generation  uint64
+	clock       Clock
+	onChange    StateChangeCallback
+	isFailure   func(error) bool
+	coolDown    time.Duration
+	openedAt    time.Time
+	consecutive int
+	maxFailures int
+	// The outcome of the last calls, for the failure rate.
+	outcomes []bool
+	next     int
+	recorded int
+	failures int
+	rate     float64
+	// Probes in flight, and successful probes, when half-open.
+	probing   int
+	succeeded int
+	maxProbes int
+}
+
+// Create a breaker with somewhat sane defaults: it opens after 5
+// consecutive failures, cools down for 30 seconds and closes again
+// after one successful probe.
+func NewBreaker() *Breaker {
+	return &Breaker{
+		clock:       time.Now,
+		coolDown:    30 * time.Second,
+		maxFailures: 5,
+		maxProbes:   1,
+	}
+}
+
+// Open the breaker after n consecutive failures. Zero turns this
+// threshold off.
+func (b *Breaker) SetConsecutiveFailures(n int) *Breaker {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.maxFailures = n
+
+	return b
+}
+
+// Open the breaker once the share of failures in the last window
+// calls reaches rate (so 0.5 for half of them). No decision is made
+// until there have been window calls. A zero window turns this
+// threshold off, as does a negative one.
+func (b *Breaker) SetFailureRate(rate float64, window int) *Breaker {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if window < 0 {
+		window = 0
+	}
+	b.rate = rate
+	b.outcomes = make([]bool, window)
+	b.clearWindow()
+
+	return b
+}
+
+// Set how long the breaker stays open before letting probes through.
+func (b *Breaker) SetCoolDown(dt time.Duration) *Breaker {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.coolDown = dt
+
+	return b
+}
+
+// Set how many successful probes it takes to close a half-open
+// breaker. At most this many probes are in flight at once.
+func (b *Breaker) SetHalfOpenProbes(n int) *Breaker {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if n < 1 {
+		n = 1
+	}
+	b.maxProbes = n
+
+	return b
+}
+
+// Decide which errors count as failures. By default, all of them do.
+// Errors not counted as failures count as successes.
+func (b *Breaker) SetIsFailure(f func(error) bool) *Breaker {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.isFailure = f
+
+	return b
+}
+
+// Set a function to call on every state change. The callback is
+// called without the breaker's lock held, so it may use the breaker,
+// but it may be called from several goroutines at once.
+func (b *Breaker) SetStateChangeCallback(f StateChangeCallback) *Breaker {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.onChange = f
+
+	return b
+}
+
+// Set the clock used for the cool-down.
+func (b *Breaker) SetClock(c Clock) *Breaker {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.clock = c
+
+	return b
+}
+
+// A state change, to report once the lock is released.
+type change struct {
+	from, to State
+	f        StateChangeCallback
+}
+
+func (c change) report() {
+	if c.f != nil && c.from != c.to {
+		c.f(c.from, c.to)
+	}
+}
+
+// Move to a new state, resetting the counters. Must be called with
+// the lock held.
+func (b *Breaker) setState(s State) change {
+	c := change{from: b.state, to: s, f: b.onChange}
+	b.state = s
+	b.generation++
+	b.consecutive = 0
+	b.probing = 0
+	b.succeeded = 0
+	b.clearWindow()
+	if s == Open {
+		b.openedAt = b.clock()
+	}
+
+	return c
+}
+
+func (b *Breaker) clearWindow() {
+	b.next = 0
+	b.recorded = 0
+	b.failures = 0
+	for ix := range b.outcomes {
+		b.outcomes[ix] = false
+	}
+}
+
+// Move from open to half-open, if the cool-down has passed. Must be
+// called with the lock held.
+func (b *Breaker) cooled() change {
+	if b.state == Open && b.clock().Sub(b.openedAt) >= b.coolDown {
+		return b.setState(HalfOpen)
+	}
+
+	return change{}
+}
+
+// Return the current state of the breaker.
+func (b *Breaker) State() State {
+	b.lock.Lock()
+	c := b.cooled()
+	s := b.state
+	b.lock.Unlock()
+	c.report()
+
+	return s
+}
+
+// Check if a call may go ahead. A call let through must be followed
+// by exactly one call to done, with the generation returned here.
+func (b *Breaker) allow() (uint64, bool, change) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	c := b.cooled()
+	switch b.state {
+	case Open:
+		return b.generation, false, c
+	case HalfOpen:
+		if b.probing+b.succeeded >= b.maxProbes {
+			return b.generation, false, c
+		}
+		b.probing++
+	}
+
+	return b.generation, true, c
+}
+
+// Record the outcome of a call that was let through. Calls let
+// through before the last state change are ignored, so that a slow
+// call started while closed does not count as a probe.
+func (b *Breaker) done(generation uint64, err error) change {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if generation != b.generation {
+		return change{}
+	}
+
+	failed := err != nil
+	if failed && b.isFailure != nil {
+		failed = b.isFailure(err)
+	}
+
+	switch b.state {
+	case HalfOpen:
+		b.probing--
+		if failed {
+			return b.setState(Open)
+		}
+		b.succeeded++
+		if b.succeeded >= b.maxProbes {
+			return b.setState(Closed)
+		}
+	case Closed:
+		if b.record(failed) {
+			return b.setState(Open)
+		}
+	}
+
+	return change{}
+}
+
+// Count the outcome of a call while closed, returning true if the
+// breaker should open. Must be called with the lock held.
+func (b *Breaker) record(failed bool) bool {
+	if failed {
+		b.consecutive++
+	} else {
+		b.consecutive = 0
+	}
+	if b.maxFailures > 0 && b.consecutive >= b.maxFailures {
+		return true
+	}
+
+	window := len(b.outcomes)
+	if window == 0 {
+		return false
+	}
+	if b.recorded == window && b.outcomes[b.next] {
+		b.failures--
+	}
+	b.outcomes[b.next] = failed
+	if failed {
+		b.failures++
+	}
+	b.next = (b.next + 1) % window
+	if b.recorded < window {
+		b.recorded++
+	}
+
+	return b.recorded == window && float64(b.failures) >= b.rate*float64(window)
+}
+
+// Call f through the breaker. If the breaker is open, f is not
+// called, and the error is backoff.Permanent(BreakerOpen), so that
+// backoff.CallWithHelper gives up straight away instead of sleeping
+// through its retries. It still matches BreakerOpen with errors.Is.
+// Otherwise, whatever f returns is returned, after its error has
+// been counted. If f panics, that counts as a failure.
+func Call[T any](b *Breaker, f func() (T, error)) (rv T, err error) {
+	generation, ok, c := b.allow()
+	c.report()
+	if !ok {
+		return rv, backoff.Permanent(BreakerOpen)
+	}
+
+	err = callPanicked
+	defer func() {
+		b.done(generation, err).report()
+	}()
+
+	return f()
+}
@@ -0,0 +1,246 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/vatine/goutils/backoff"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+var failing = errors.New("failing")
+
+func fail() (int, error) {
+	return 0, failing
+}
+
+func succeed() (int, error) {
+	return 1, nil
+}
+
+type transitions []string
+
+func (t *transitions) record(from, to State) {
+	*t = append(*t, fmt.Sprintf("%v->%v", from, to))
+}
+
+func TestConsecutiveFailures(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	var seen transitions
+	b := NewBreaker().SetConsecutiveFailures(3).SetCoolDown(10 * time.Second).SetClock(clock.Now).SetStateChangeCallback(seen.record)
+
+	// A success in between resets the count.
+	Call(b, fail)
+	Call(b, fail)
+	Call(b, succeed)
+	Call(b, fail)
+	Call(b, fail)
+	if s := b.State(); s != Closed {
+		t.Fatalf("Want closed, saw %v", s)
+	}
+
+	Call(b, fail)
+	if s := b.State(); s != Open {
+		t.Fatalf("Want open, saw %v", s)
+	}
+
+	called := false
+	_, err := Call(b, func() (int, error) {
+		called = true
+		return 0, nil
+	})
+	if called {
+		t.Errorf("Open breaker called the function")
+	}
+	if !errors.Is(err, BreakerOpen) {
+		t.Errorf("Want BreakerOpen, saw %v", err)
+	}
+
+	clock.now = clock.now.Add(10 * time.Second)
+	if s := b.State(); s != HalfOpen {
+		t.Fatalf("Want half-open after the cool-down, saw %v", s)
+	}
+
+	// A failed probe opens the breaker again, for a full cool-down.
+	Call(b, fail)
+	clock.now = clock.now.Add(5 * time.Second)
+	if s := b.State(); s != Open {
+		t.Fatalf("Want open after a failed probe, saw %v", s)
+	}
+	clock.now = clock.now.Add(5 * time.Second)
+	if v, err := Call(b, succeed); v != 1 || err != nil {
+		t.Errorf("Probe returned %d, %v", v, err)
+	}
+	if s := b.State(); s != Closed {
+		t.Errorf("Want closed after a good probe, saw %v", s)
+	}
+
+	want := transitions{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Errorf("Want transitions %v, saw %v", want, seen)
+	}
+}
+
+func TestFailureRate(t *testing.T) {
+	b := NewBreaker().SetConsecutiveFailures(0).SetFailureRate(0.5, 4)
+
+	// Nothing is decided until the window is full.
+	Call(b, fail)
+	Call(b, fail)
+	Call(b, fail)
+	if s := b.State(); s != Closed {
+		t.Fatalf("Want closed before the window is full, saw %v", s)
+	}
+
+	b = NewBreaker().SetConsecutiveFailures(0).SetFailureRate(0.5, 4)
+	for _, f := range []func() (int, error){fail, succeed, succeed, succeed, fail, succeed} {
+		Call(b, f)
+	}
+	if s := b.State(); s != Closed {
+		t.Fatalf("Want closed at 25%% failures, saw %v", s)
+	}
+	// The window is now succeed, succeed, fail, succeed. One more
+	// failure pushes out a success and makes it 50%.
+	Call(b, fail)
+	if s := b.State(); s != Open {
+		t.Errorf("Want open at 50%% failures, saw %v", s)
+	}
+}
+
+func TestHalfOpenProbes(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	b := NewBreaker().SetConsecutiveFailures(1).SetHalfOpenProbes(2).SetCoolDown(time.Second).SetClock(clock.Now)
+
+	Call(b, fail)
+	clock.now = clock.now.Add(time.Second)
+
+	// While a probe is in flight, only one more gets through.
+	var inner, innermost error
+	Call(b, func() (int, error) {
+		_, inner = Call(b, func() (int, error) {
+			_, innermost = Call(b, succeed)
+			return 1, nil
+		})
+		return 1, nil
+	})
+	if inner != nil {
+		t.Errorf("Second probe was rejected, %v", inner)
+	}
+	if !errors.Is(innermost, BreakerOpen) {
+		t.Errorf("Third probe was let through, %v", innermost)
+	}
+	if s := b.State(); s != Closed {
+		t.Errorf("Want closed after 2 good probes, saw %v", s)
+	}
+}
+
+func TestIsFailure(t *testing.T) {
+	b := NewBreaker().SetConsecutiveFailures(1).SetIsFailure(func(err error) bool {
+		return !errors.Is(err, context.Canceled)
+	})
+
+	Call(b, func() (int, error) { return 0, context.Canceled })
+	if s := b.State(); s != Closed {
+		t.Errorf("Want closed after an ignored error, saw %v", s)
+	}
+	Call(b, fail)
+	if s := b.State(); s != Open {
+		t.Errorf("Want open after a failure, saw %v", s)
+	}
+}
+
+func TestWithBackoff(t *testing.T) {
+	b := NewBreaker().SetConsecutiveFailures(3)
+	helper := backoff.NewConstant(time.Millisecond).SetRetries(10)
+
+	calls := 0
+	before := time.Now()
+	_, err := backoff.CallWithHelper(helper, func() (int, error) {
+		return Call(b, func() (int, error) {
+			calls++
+			return 0, failing
+		})
+	})
+
+	if calls != 3 {
+		t.Errorf("Want 3 calls, saw %d", calls)
+	}
+	if err != BreakerOpen {
+		t.Errorf("Want BreakerOpen, saw %v", err)
+	}
+	if elapsed := time.Since(before); elapsed > 100*time.Millisecond {
+		t.Errorf("Kept retrying for %v with an open breaker", elapsed)
+	}
+}
+
+func TestStaleCall(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	b := NewBreaker().SetConsecutiveFailures(1).SetCoolDown(time.Second).SetClock(clock.Now)
+
+	// A slow call, let through while closed, finishes once the
+	// breaker has opened and cooled down.
+	Call(b, func() (int, error) {
+		Call(b, fail)
+		clock.now = clock.now.Add(time.Second)
+		if s := b.State(); s != HalfOpen {
+			t.Fatalf("Want half-open, saw %v", s)
+		}
+		return 1, nil
+	})
+
+	if s := b.State(); s != HalfOpen {
+		t.Errorf("Stale success changed the state to %v", s)
+	}
+	if _, err := Call(b, succeed); err != nil {
+		t.Errorf("Probe was rejected, %v", err)
+	}
+	if s := b.State(); s != Closed {
+		t.Errorf("Want closed after a good probe, saw %v", s)
+	}
+}
+
+func TestPanickingProbe(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	b := NewBreaker().SetConsecutiveFailures(1).SetCoolDown(time.Second).SetClock(clock.Now)
+
+	Call(b, fail)
+	clock.now = clock.now.Add(time.Second)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Panic was swallowed")
+			}
+		}()
+		Call(b, func() (int, error) {
+			panic("boom")
+		})
+	}()
+
+	// The panic counts as a failed probe, rather than holding the
+	// probe slot forever.
+	if s := b.State(); s != Open {
+		t.Errorf("Want open after a panicking probe, saw %v", s)
+	}
+	clock.now = clock.now.Add(time.Second)
+	if _, err := Call(b, succeed); err != nil {
+		t.Errorf("Probe was rejected, %v", err)
+	}
+}
+
+func TestNegativeWindow(t *testing.T) {
+	b := NewBreaker().SetFailureRate(0.5, -1)
+	if _, err := Call(b, succeed); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Command cachesim replays a key-access trace against the caches in
+// the cache package, at several sizes, and prints the hit ratio for
+// each. Traces are either read from a file (plain text with one key
+// per line, or CSV with a timestamp and a key per line), or generated.
+//
+// Usage:
+//
+//	cachesim -trace access.log -sizes 100,1000,10000
+//	cachesim -generate zipf -n 100000 -keys 10000 -zipf-s 1.2
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func parseSizes(s string) ([]int, error) {
+	var rv []int
+
+	for _, part := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("bad cache size %q", part)
+		}
+		rv = append(rv, n)
+	}
+
+	return rv, nil
+}
+
+func loadTrace(path, format string) ([]access, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if format == "auto" {
+		format = "text"
+		if strings.HasSuffix(path, ".csv") {
+			format = "csv"
+		}
+	}
+
+	switch format {
+	case "text":
+		return readText(f)
+	case "csv":
+		return readCSV(f)
+	}
+
+	return nil, fmt.Errorf("unknown trace format %q", format)
+}
+
+func report(w io.Writer, results []result) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "policy\tsize\thits\taccesses\thit ratio\t")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.4f\t\n", r.policy, r.size, r.hits, r.accesses, r.ratio())
+	}
+	tw.Flush()
+}
+
+// Report a problem with the command line, and exit.
+func usage(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	flag.Usage()
+	os.Exit(2)
+}
+
+func main() {
+	tracePath := flag.String("trace", "", "Trace file to replay")
+	format := flag.String("format", "auto", "Trace format: text, csv or auto (csv for files ending in .csv)")
+	generate := flag.String("generate", "", "Generate a synthetic trace instead: zipf or scan")
+	n := flag.Int("n", 100000, "Number of accesses to generate")
+	keys := flag.Int("keys", 10000, "Number of distinct keys to generate")
+	zipfS := flag.Float64("zipf-s", 1.1, "Zipf skew parameter, must be > 1")
+	seed := flag.Int64("seed", 1, "Random seed for generated traces")
+	sizesFlag := flag.String("sizes", "100,1000,10000", "Comma-separated cache sizes to simulate")
+	maxAge := flag.Duration("max-age", 0, "Maximum age for the LRU and LRW caches")
+	afterAccess := flag.Duration("after-access", 0, "Expiry after access for the expiring cache")
+	afterWrite := flag.Duration("after-write", 0, "Expiry after write for the expiring cache")
+	tick := flag.Duration("tick", time.Millisecond, "Time between accesses, for traces without timestamps")
+	flag.Parse()
+
+	sizes, err := parseSizes(*sizesFlag)
+	if err != nil {
+		usage(err)
+	}
+
+	var trace []access
+	switch {
+	case *generate != "":
+		trace, err = generateTrace(*generate, *seed, *n, *keys, *zipfS)
+		if err != nil {
+			usage(err)
+		}
+	case *tracePath != "":
+		trace, err = loadTrace(*tracePath, *format)
+	default:
+		usage(fmt.Errorf("need either -trace or -generate"))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	policies := []namedFactory{
+		{"LRU", lruFactory(*maxAge)},
+		{"LRW", lrwFactory(*maxAge)},
+	}
+	if *afterAccess > 0 || *afterWrite > 0 {
+		policies = append(policies, namedFactory{"Expiring", expiringFactory(*afterAccess, *afterWrite)})
+	}
+
+	var results []result
+	for _, p := range policies {
+		r, err := run(p.name, p.f, sizes, trace, *tick)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		results = append(results, r...)
+	}
+
+	report(os.Stdout, results)
+}
@@ -0,0 +1,151 @@
+package main
+
+// Replaying traces against the caches in the cache package.
+
+import (
+	"time"
+
+	"github.com/vatine/goutils/cache"
+)
+
+// A cache under simulation.
+type policy interface {
+	get(k string) bool
+	set(k string)
+}
+
+// Build a cache of a given size, using a given clock.
+type factory func(size int, clock cache.Clock) (policy, error)
+
+type namedFactory struct {
+	name string
+	f    factory
+}
+
+type lruPolicy struct {
+	c *cache.LRU[string, struct{}]
+}
+
+func (p lruPolicy) get(k string) bool {
+	_, ok := cache.GetLRU(p.c, k)
+	return ok
+}
+
+func (p lruPolicy) set(k string) {
+	cache.SetLRU(p.c, k, struct{}{})
+}
+
+type lrwPolicy struct {
+	c *cache.LRW[string, struct{}]
+}
+
+func (p lrwPolicy) get(k string) bool {
+	_, ok := cache.GetLRW(p.c, k)
+	return ok
+}
+
+func (p lrwPolicy) set(k string) {
+	cache.SetLRW(p.c, k, struct{}{})
+}
+
+type expiringPolicy struct {
+	c *cache.Expiring[string, struct{}]
+}
+
+func (p expiringPolicy) get(k string) bool {
+	_, ok := cache.GetExpiring(p.c, k)
+	return ok
+}
+
+func (p expiringPolicy) set(k string) {
+	cache.SetExpiring(p.c, k, struct{}{})
+}
+
+func lruFactory(maxAge time.Duration) factory {
+	return func(size int, clock cache.Clock) (policy, error) {
+		c, err := cache.NewLRUCache("", struct{}{}, size, maxAge)
+		if err != nil {
+			return nil, err
+		}
+		cache.SetClockLRU(c, clock)
+		return lruPolicy{c}, nil
+	}
+}
+
+func lrwFactory(maxAge time.Duration) factory {
+	return func(size int, clock cache.Clock) (policy, error) {
+		c, err := cache.NewLRWCache("", struct{}{}, size, maxAge)
+		if err != nil {
+			return nil, err
+		}
+		cache.SetClockLRW(c, clock)
+		return lrwPolicy{c}, nil
+	}
+}
+
+func expiringFactory(afterAccess, afterWrite time.Duration) factory {
+	return func(size int, clock cache.Clock) (policy, error) {
+		c, err := cache.NewExpiringCache("", struct{}{}, size, afterAccess, afterWrite)
+		if err != nil {
+			return nil, err
+		}
+		cache.SetClockExpiring(c, clock)
+		return expiringPolicy{c}, nil
+	}
+}
+
+// The outcome of replaying a trace against one cache.
+type result struct {
+	policy   string
+	size     int
+	hits     int
+	accesses int
+}
+
+func (r result) ratio() float64 {
+	if r.accesses == 0 {
+		return 0
+	}
+
+	return float64(r.hits) / float64(r.accesses)
+}
+
+// Replay a trace against a cache, looking up every key and storing it
+// on a miss. Accesses without a timestamp are spaced tick apart.
+func simulate(trace []access, p policy, setClock func(time.Time), tick time.Duration) (hits int) {
+	synthetic := time.Unix(0, 0)
+
+	for _, a := range trace {
+		if a.at.IsZero() {
+			synthetic = synthetic.Add(tick)
+			setClock(synthetic)
+		} else {
+			setClock(a.at)
+		}
+
+		if p.get(a.key) {
+			hits++
+		} else {
+			p.set(a.key)
+		}
+	}
+
+	return hits
+}
+
+// Replay a trace against a cache built by f for each of the sizes.
+func run(name string, f factory, sizes []int, trace []access, tick time.Duration) ([]result, error) {
+	var rv []result
+
+	for _, size := range sizes {
+		var now time.Time
+		p, err := f(size, func() time.Time { return now })
+		if err != nil {
+			return nil, err
+		}
+		hits := simulate(trace, p, func(t time.Time) { now = t }, tick)
+		rv = append(rv, result{policy: name, size: size, hits: hits, accesses: len(trace)})
+	}
+
+	return rv, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunScan(t *testing.T) {
+	// Scanning through more keys than fit in the cache never hits,
+	// scanning through fewer hits on everything after the first pass.
+	trace := generateScan(100, 10)
+
+	results, err := run("LRU", lruFactory(0), []int{5, 10}, trace, time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if results[0].hits != 0 {
+		t.Errorf("Size 5, want no hits, saw %d", results[0].hits)
+	}
+	if results[1].hits != 90 {
+		t.Errorf("Size 10, want 90 hits, saw %d", results[1].hits)
+	}
+	if r := results[1].ratio(); r != 0.9 {
+		t.Errorf("Size 10, want ratio 0.9, saw %f", r)
+	}
+}
+
+func TestRunTimestamps(t *testing.T) {
+	at := func(s int64) time.Time { return time.Unix(s, 0) }
+	// Writing b ages out a from the LRW cache (last written 12s
+	// ago), but not from the LRU cache (last read 4s ago).
+	trace := []access{
+		{"a", at(0)},
+		{"a", at(8)},
+		{"b", at(12)},
+		{"a", at(13)},
+	}
+
+	cases := []struct {
+		name string
+		f    factory
+		hits int
+	}{
+		{"LRU", lruFactory(10 * time.Second), 2},
+		{"LRW", lrwFactory(10 * time.Second), 1},
+		{"Expiring", expiringFactory(10*time.Second, 0), 2},
+	}
+
+	for ix, tc := range cases {
+		results, err := run(tc.name, tc.f, []int{10}, trace, time.Millisecond)
+		if err != nil {
+			t.Fatalf("Case #%d, unexpected error %v", ix, err)
+		}
+		if results[0].hits != tc.hits {
+			t.Errorf("Case #%d (%s), want %d hits, saw %d", ix, tc.name, tc.hits, results[0].hits)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+// Reading and generating key-access traces.
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A single access to a key. If At is the zero time, the trace has no
+// timestamps and the simulation makes up its own.
+type access struct {
+	key string
+	at  time.Time
+}
+
+// Read a plain text trace, one key per line. Blank lines are skipped.
+func readText(r io.Reader) ([]access, error) {
+	var rv []access
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key := strings.TrimSpace(scanner.Text())
+		if key == "" {
+			continue
+		}
+		rv = append(rv, access{key: key})
+	}
+
+	return rv, scanner.Err()
+}
+
+// Parse a timestamp, either as RFC 3339 or as (possibly fractional)
+// seconds since the Unix epoch.
+func parseTimestamp(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unparseable timestamp %q", s)
+	}
+
+	return time.Unix(0, int64(secs*float64(time.Second))), nil
+}
+
+// Read a CSV trace, with a timestamp and a key on each line. A first
+// line that does not start with a valid timestamp is taken to be a
+// header, and skipped.
+func readCSV(r io.Reader) ([]access, error) {
+	var rv []access
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rv, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		at, err := parseTimestamp(record[0])
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		rv = append(rv, access{key: record[1], at: at})
+	}
+}
+
+// Generate a synthetic trace of n accesses over keys distinct keys,
+// using the named generator. Returns an error for unknown generators
+// or parameters the generator can not work with.
+func generateTrace(name string, seed int64, n, keys int, s float64) ([]access, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("-n must be at least 0, not %d", n)
+	}
+
+	switch name {
+	case "zipf":
+		if s <= 1 || keys < 2 {
+			return nil, fmt.Errorf("zipf needs -zipf-s > 1 and -keys > 1")
+		}
+		return generateZipf(rand.New(rand.NewSource(seed)), n, keys, s), nil
+	case "scan":
+		if keys < 1 {
+			return nil, fmt.Errorf("scan needs -keys > 0")
+		}
+		return generateScan(n, keys), nil
+	}
+
+	return nil, fmt.Errorf("unknown generator %q", name)
+}
+
+// Generate n accesses to keys following a Zipf distribution with
+// parameter s (> 1) over a universe of keys keys.
+func generateZipf(rng *rand.Rand, n, keys int, s float64) []access {
+	rv := make([]access, n)
+	zipf := rand.NewZipf(rng, s, 1, uint64(keys-1))
+
+	for i := range rv {
+		rv[i].key = strconv.FormatUint(zipf.Uint64(), 10)
+	}
+
+	return rv
+}
+
+// Generate n accesses scanning repeatedly through a universe of keys
+// keys, in order. This is the classic worst case for LRU.
+func generateScan(n, keys int) []access {
+	rv := make([]access, n)
+
+	for i := range rv {
+		rv[i].key = strconv.Itoa(i % keys)
+	}
+
+	return rv
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadText(t *testing.T) {
+	trace, err := readText(strings.NewReader("a\n\n b \nc\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	want := []string{"a", "b", "c"}
+	if len(trace) != len(want) {
+		t.Fatalf("Want %d accesses, saw %d", len(want), len(trace))
+	}
+	for ix, w := range want {
+		if trace[ix].key != w || !trace[ix].at.IsZero() {
+			t.Errorf("Access #%d, want key %s without timestamp, saw %+v", ix, w, trace[ix])
+		}
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	input := "time,key\n1.5,a\n2017-01-02T03:04:05Z,b\n"
+	trace, err := readCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	want := []access{
+		{"a", time.Unix(1, 500000000)},
+		{"b", time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}
+	if len(trace) != len(want) {
+		t.Fatalf("Want %d accesses, saw %d", len(want), len(trace))
+	}
+	for ix, w := range want {
+		if trace[ix].key != w.key || !trace[ix].at.Equal(w.at) {
+			t.Errorf("Access #%d, want %+v, saw %+v", ix, w, trace[ix])
+		}
+	}
+
+	if _, err := readCSV(strings.NewReader("1,a\nnope,b\n")); err == nil {
+		t.Errorf("Expected an error for a bad timestamp")
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	zipf := generateZipf(rand.New(rand.NewSource(1)), 1000, 100, 1.5)
+	counts := make(map[string]int)
+	for _, a := range zipf {
+		counts[a.key]++
+	}
+	if len(zipf) != 1000 || len(counts) > 100 {
+		t.Errorf("Unexpected zipf trace, %d accesses over %d keys", len(zipf), len(counts))
+	}
+	if counts["0"] < counts["50"] {
+		t.Errorf("Zipf trace not skewed, %d accesses to 0, %d to 50", counts["0"], counts["50"])
+	}
+
+	scan := generateScan(7, 3)
+	got := ""
+	for _, a := range scan {
+		got += a.key
+	}
+	if got != "0120120" {
+		t.Errorf("Unexpected scan trace %s", got)
+	}
+}
+
+func TestGenerateTrace(t *testing.T) {
+	cases := []struct {
+		name    string
+		n, keys int
+		s       float64
+		ok      bool
+	}{
+		{"scan", 10, 3, 0, true},
+		{"scan", 0, 3, 0, true},
+		{"scan", 10, 0, 0, false},
+		{"scan", -1, 3, 0, false},
+		{"zipf", 10, 5, 1.2, true},
+		{"zipf", 10, 1, 1.2, false},
+		{"zipf", 10, 5, 1, false},
+		{"zipf", -1, 5, 1.2, false},
+		{"nope", 10, 5, 1.2, false},
+	}
+
+	for ix, tc := range cases {
+		trace, err := generateTrace(tc.name, 1, tc.n, tc.keys, tc.s)
+		if ok := err == nil; ok != tc.ok {
+			t.Errorf("Case #%d, want ok %v, saw error %v", ix, tc.ok, err)
+		}
+		if err == nil && len(trace) != tc.n {
+			t.Errorf("Case #%d, want %d accesses, saw %d", ix, tc.n, len(trace))
+		}
+	}
+}